@@ -0,0 +1,312 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// maximum number of LSF commands run at the same time
+const max_concurrent_commands = 8
+
+// jobAction is an LSF command that can be run on one or more jobs
+type jobAction struct {
+	key  string
+	name string
+	cmd  string
+	args []string
+	// text prompted for and appended to args before running, e.g. a signal
+	prompt         string
+	prompt_default string
+	// split the prompted text into several arguments, e.g. bmod options
+	split_prompt bool
+	// run in place of an LSF command, for actions that don't need confirming
+	apply func(text string, targets []string)
+}
+
+var job_actions = []jobAction{
+	{key: "s", name: "Suspend", cmd: "bstop"},
+	{key: "r", name: "Resume", cmd: "bresume"},
+	{key: "R", name: "Requeue", cmd: "brequeue"},
+	{key: "k", name: "Kill with signal", cmd: "bkill", args: []string{"-s"}, prompt: "Signal to send: ", prompt_default: "SIGTERM"},
+	{key: "K", name: "Kill with reason", cmd: "bkill", args: []string{"-C"}, prompt: "Reason for killing: "},
+}
+
+// actions offered for the set of marked jobs
+var bulk_actions = []jobAction{
+	{key: "k", name: "Kill", cmd: "bkill"},
+	{key: "R", name: "Requeue", cmd: "brequeue"},
+	{key: "m", name: "Modify", cmd: "bmod", prompt: "bmod options: ", split_prompt: true},
+	{key: "w", name: "Switch queue", cmd: "bswitch", prompt: "Switch to queue: "},
+	{key: "x", name: "Export job IDs", prompt: "Export job IDs to file: ", prompt_default: "bj_jobids.txt", apply: export_jobids},
+}
+
+// commandResult is the outcome of running one LSF command
+type commandResult struct {
+	args   []string
+	output string
+	err    error
+}
+
+// jobs the next action applies to: the marked jobs if there are any,
+// otherwise just the selected one
+func action_targets() []string {
+	var targets []string
+	for id := range marked_jobids {
+		targets = append(targets, id)
+	}
+	if len(targets) == 0 && selected_jobid != "" {
+		targets = append(targets, selected_jobid)
+	}
+	sort.Slice(targets, func(i, j int) bool { return jobid_less(targets[i], targets[j]) })
+	return targets
+}
+
+// order job IDs numerically, so "9999" comes before "10000"
+func jobid_less(a string, b string) bool {
+	a_num, a_err := strconv.Atoi(strings.SplitN(a, "[", 2)[0])
+	b_num, b_err := strconv.Atoi(strings.SplitN(b, "[", 2)[0])
+	if a_err == nil && b_err == nil && a_num != b_num {
+		return a_num < b_num
+	}
+	return a < b
+}
+
+// the menu of actions that can be run on the target jobs
+func open_action_menu(title string, actions []jobAction, targets []string, db map[string]recStruct) {
+	lines := []string{"Act on " + describe_targets(targets, db) + ":", ""}
+	for _, action := range actions {
+		line := "  [" + action.key + "] " + action.name
+		if action.cmd != "" {
+			line += " (" + action.cmd + ")"
+		}
+		lines = append(lines, line)
+	}
+
+	open_modal(title, lines, "Choose an action  Cancel [Esc] ", func(key string) bool {
+		if key == "<Escape>" || key == "q" {
+			return true
+		}
+		for _, action := range actions {
+			if action.key != key {
+				continue
+			}
+			if action.prompt == "" {
+				confirm_action(action, targets)
+				return false
+			}
+			// collect the signal, reason or options before asking for confirmation
+			action := action
+			open_prompt(action.prompt, action.prompt_default, func(text string) {
+				if strings.TrimSpace(text) == "" {
+					async_statusline_message("Error: "+strings.TrimSuffix(action.prompt, ": ")+" can't be empty", 2)
+					return
+				}
+				if action.apply != nil {
+					action.apply(text, targets)
+					return
+				}
+				if action.split_prompt {
+					action.args = append(append([]string{}, action.args...), split_args(text)...)
+				} else {
+					action.args = append(append([]string{}, action.args...), text)
+				}
+				confirm_action(action, targets)
+			}, nil)
+			return true
+		}
+		return false
+	})
+}
+
+// ask for confirmation listing every job an action will be run on
+func confirm_action(action jobAction, targets []string) {
+	command := strings.Join(append([]string{action.cmd}, action.args...), " ")
+	lines := []string{action.name + " " + describe_jobids(targets) + " with `" + command + "`?", ""}
+	lines = append(lines, targets...)
+
+	open_modal("Confirm "+strings.ToLower(action.name), lines, "Confirm [y]  Cancel [n] ", func(key string) bool {
+		switch key {
+		case "y":
+			var cmds [][]string
+			for _, id := range targets {
+				cmds = append(cmds, append(append([]string{action.cmd}, action.args...), id))
+			}
+			marked_jobids = make(map[string]bool)
+			start_commands(action.name, cmds)
+			return true
+		case "n", "<Escape>", "q":
+			return true
+		}
+		return false
+	})
+}
+
+// run the commands in the background so the interface keeps taking keys,
+// showing progress on the statusline and the results once all have finished
+func start_commands(title string, cmds [][]string) {
+	statusline.TextStyle.Fg = ColorYellow
+	statusline.Text = title + ": running " + strconv.Itoa(len(cmds)) + " commands"
+	ui.Render(statusline_grid)
+
+	go func() {
+		results := run_commands(cmds, func(done int, total int) {
+			ui_updates <- func() {
+				if active_prompt == nil && active_modal == nil {
+					statusline.TextStyle.Fg = ColorYellow
+					statusline.Text = title + ": " + strconv.Itoa(done) + "/" + strconv.Itoa(total) + " commands finished"
+					ui.Render(statusline_grid)
+				}
+			}
+		})
+
+		ui_updates <- func() {
+			statusline.TextStyle.Fg = ColorGrey
+			show_command_results(title, results)
+		}
+	}()
+}
+
+// report which commands succeeded and which failed, with LSF's error output
+func show_command_results(title string, results []commandResult) {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	lines := []string{strconv.Itoa(len(results)-failed) + " succeeded, " + strconv.Itoa(failed) + " failed", ""}
+	for _, result := range results {
+		status := "[✔](fg:green) "
+		if result.err != nil {
+			status = "[✘](fg:red) "
+		}
+		lines = append(lines, status+strings.Join(result.args, " "))
+		if result.err != nil {
+			output := strings.TrimSpace(result.output)
+			if output == "" {
+				output = result.err.Error()
+			}
+			for _, line := range strings.Split(output, "\n") {
+				lines = append(lines, "    "+line)
+			}
+		}
+	}
+
+	open_modal(title+" results", lines, "Close [q] ", func(key string) bool {
+		return key == "q" || key == "<Escape>" || key == "<Enter>"
+	})
+}
+
+// run LSF commands concurrently, returning the results in the same order,
+// and calling progress (when not nil) as each command finishes
+func run_commands(cmds [][]string, progress func(done int, total int)) []commandResult {
+	results := make([]commandResult, len(cmds))
+	slots := make(chan bool, max_concurrent_commands)
+	var wg sync.WaitGroup
+	var done_lock sync.Mutex
+	done := 0
+
+	for i, args := range cmds {
+		wg.Add(1)
+		slots <- true
+		go func(i int, args []string) {
+			defer wg.Done()
+			output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+			results[i] = commandResult{args: args, output: string(output), err: err}
+			<-slots
+
+			if progress != nil {
+				done_lock.Lock()
+				done++
+				progress(done, len(cmds))
+				done_lock.Unlock()
+			}
+		}(i, args)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// a short description of a list of job IDs for menus and prompts
+func describe_jobids(jobids []string) string {
+	if len(jobids) == 1 {
+		return "job " + jobids[0]
+	}
+	return strconv.Itoa(len(jobids)) + " jobs"
+}
+
+// describe the target jobs along with how many are in each status,
+// e.g. "12 jobs (8 EXIT, 4 PEND)"
+func describe_targets(targets []string, db map[string]recStruct) string {
+	stat_counts := make(map[string]int)
+	var stats []string
+	for _, id := range targets {
+		stat := db[id].STAT
+		if stat == "" {
+			stat = "unknown"
+		}
+		if stat_counts[stat] == 0 {
+			stats = append(stats, stat)
+		}
+		stat_counts[stat]++
+	}
+	sort.Slice(stats, func(i, j int) bool { return stat_counts[stats[i]] > stat_counts[stats[j]] })
+
+	var counts []string
+	for _, stat := range stats {
+		counts = append(counts, strconv.Itoa(stat_counts[stat])+" "+stat)
+	}
+	return describe_jobids(targets) + " (" + strings.Join(counts, ", ") + ")"
+}
+
+// split typed options into arguments, keeping quoted text together so that
+// e.g. -R "rusage[mem=4000]" stays a single argument
+func split_args(text string) []string {
+	var args []string
+	var current strings.Builder
+	in_arg := false
+	quote := rune(0)
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			in_arg = true
+		case r == ' ' || r == '\t':
+			if in_arg {
+				args = append(args, current.String())
+				current.Reset()
+				in_arg = false
+			}
+		default:
+			current.WriteRune(r)
+			in_arg = true
+		}
+	}
+	if in_arg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// write the target job IDs to a file, one per line
+func export_jobids(path string, targets []string) {
+	err := ioutil.WriteFile(path, []byte(strings.Join(targets, "\n")+"\n"), 0644)
+	if err != nil {
+		statusline.TextStyle.Fg = ColorRed
+		async_statusline_message("Error exporting job IDs: "+err.Error(), 3)
+		return
+	}
+	async_statusline_message("Exported "+describe_jobids(targets)+" to "+path, 3)
+}
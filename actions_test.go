@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+// Test that job IDs are ordered numerically rather than lexically
+func TestJobidLess(t *testing.T) {
+	ids := []string{"10000", "9999", "81061[2]", "81061[10]", "79913"}
+	sort.Slice(ids, func(i, j int) bool { return jobid_less(ids[i], ids[j]) })
+
+	expected := []string{"9999", "10000", "79913", "81061[10]", "81061[2]"}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, ids)
+			break
+		}
+	}
+}
+
+// Test that actions apply to the marked jobs, or the selected job when none are marked
+func TestActionTargets(t *testing.T) {
+	defer func() {
+		marked_jobids = make(map[string]bool)
+		selected_jobid = ""
+	}()
+
+	selected_jobid = "81061"
+	marked_jobids = make(map[string]bool)
+
+	targets := action_targets()
+	if len(targets) != 1 || targets[0] != "81061" {
+		t.Errorf("Expected only the selected job, got %v", targets)
+	}
+
+	marked_jobids["79913"] = true
+	marked_jobids["10000"] = true
+	targets = action_targets()
+	if len(targets) != 2 || targets[0] != "10000" || targets[1] != "79913" {
+		t.Errorf("Expected the marked jobs in numeric order, got %v", targets)
+	}
+
+	selected_jobid = ""
+	marked_jobids = make(map[string]bool)
+	if len(action_targets()) != 0 {
+		t.Error("Expected no targets when nothing is selected or marked")
+	}
+}
+
+// Test that commands are run and their failures reported in order
+func TestRunCommands(t *testing.T) {
+	cmds := [][]string{
+		{"true", "81061"},
+		{"false", "79913"},
+		{"sh", "-c", "echo Job has already finished; exit 1"},
+	}
+	results := run_commands(cmds, nil)
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].err != nil {
+		t.Errorf("Expected first command to succeed, got %v", results[0].err)
+	}
+	if results[1].err == nil {
+		t.Error("Expected second command to fail")
+	}
+	if results[2].output != "Job has already finished\n" {
+		t.Errorf("Expected command output to be kept, got %q", results[2].output)
+	}
+	if results[1].args[1] != "79913" {
+		t.Errorf("Expected results in the order commands were given, got %v", results[1].args)
+	}
+}
+
+// Test that typed options are split into arguments, keeping quoted text together
+func TestSplitArgs(t *testing.T) {
+	args := split_args(`-M 20G -R "rusage[mem=20000] span[hosts=1]"  -q 'long queue'`)
+	expected := []string{"-M", "20G", "-R", "rusage[mem=20000] span[hosts=1]", "-q", "long queue"}
+	if len(args) != len(expected) {
+		t.Fatalf("Expected %d arguments, got %d: %q", len(expected), len(args), args)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("Expected argument %d to be %q, got %q", i, expected[i], args[i])
+		}
+	}
+
+	// an empty quoted argument is still an argument
+	if len(split_args(`-C ""`)) != 2 {
+		t.Error("Expected empty quotes to give an empty argument")
+	}
+}
+
+// Test the status breakdown shown in the bulk action menu
+func TestDescribeTargets(t *testing.T) {
+	db := map[string]recStruct{
+		"1": {JOBID: "1", STAT: "EXIT"},
+		"2": {JOBID: "2", STAT: "EXIT"},
+		"3": {JOBID: "3", STAT: "PEND"},
+	}
+
+	result := describe_targets([]string{"1", "2", "3"}, db)
+	if result != "3 jobs (2 EXIT, 1 PEND)" {
+		t.Errorf("Unexpected description %q", result)
+	}
+}
+
+// Test marking every listed job and clearing the marks again
+func TestToggleMarkAll(t *testing.T) {
+	defer func() {
+		marked_jobids = make(map[string]bool)
+		table_jobids = nil
+	}()
+
+	table_jobids = []string{"81061", "79913"}
+	marked_jobids = map[string]bool{"81061": true}
+
+	toggle_mark_all()
+	if len(marked_jobids) != 2 {
+		t.Errorf("Expected every listed job to be marked, got %v", marked_jobids)
+	}
+
+	toggle_mark_all()
+	if len(marked_jobids) != 0 {
+		t.Errorf("Expected marks to be cleared when all were marked, got %v", marked_jobids)
+	}
+}
+
+// Test that marking every job over a filter for pending jobs marks them,
+// now that pending jobs are listed in the table
+func TestMarkAllSelectsPendingJobs(t *testing.T) {
+	defer func() {
+		marked_jobids = make(map[string]bool)
+		table_jobids = nil
+		active_filter = jobFilter{}
+	}()
+
+	db := map[string]recStruct{
+		"1": {JOBID: "1", STAT: "PEND", QUEUE: "long"},
+		"2": {JOBID: "2", STAT: "PEND", QUEUE: "short"},
+		"3": {JOBID: "3", STAT: "RUN", QUEUE: "long"},
+		"4": {JOBID: "4", STAT: "PEND", QUEUE: "long"},
+	}
+	filter, err := parse_filter("stat:PEND queue:long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active_filter = filter
+	marked_jobids = make(map[string]bool)
+
+	var shown map[string]int
+	table_jobids, shown = list_jobs(db)
+	if shown["PEND"] != 2 {
+		t.Errorf("Expected 2 pending jobs shown, got %v", shown)
+	}
+
+	toggle_mark_all()
+	if len(marked_jobids) != 2 || !marked_jobids["1"] || !marked_jobids["4"] {
+		t.Errorf("Expected the pending long jobs to be marked, got %v", marked_jobids)
+	}
+}
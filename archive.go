@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// archives are named by when they were made, which is also how they're
+// picked out with `bj archive show`
+const archive_time_format = "20060102-150405"
+
+// archiveInfo describes one archived clear of a project's cache
+type archiveInfo struct {
+	id     string
+	path   string
+	time   time.Time
+	counts map[string]int // jobs by status
+	total  int
+}
+
+// the directory beside a project's store holding what was cleared from it
+func archive_dir(usr_config string) string {
+	return strings.TrimSuffix(usr_config, ".db") + "-archive/"
+}
+
+// a path for a new archive, which never replaces an existing one
+func new_archive_path(dir string, now time.Time) string {
+	id := now.Format(archive_time_format)
+	path := dir + id + ".db"
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s%s-%d.db", dir, id, n)
+	}
+}
+
+// the time an archive was made and its number among those made in the
+// same second, 1 for the first which has no number
+func split_archive_id(id string) (string, int) {
+	if len(id) > len(archive_time_format)+1 && id[len(archive_time_format)] == '-' {
+		if seq, err := strconv.Atoi(id[len(archive_time_format)+1:]); err == nil {
+			return id[:len(archive_time_format)], seq
+		}
+	}
+	return id, 1
+}
+
+// copy jobs with their events, samples and index entries from one store
+// to another, leaving any the destination already has alone
+func copy_jobs(src *bolt.Tx, dst *bolt.Tx, ids []string) error {
+	copying := make(map[string]bool)
+	src_jobs := src.Bucket(jobs_bucket)
+	dst_jobs := dst.Bucket(jobs_bucket)
+	for _, id := range ids {
+		value := src_jobs.Get([]byte(id))
+		if value == nil || dst_jobs.Get([]byte(id)) != nil {
+			continue
+		}
+		copying[id] = true
+
+		var job recStruct
+		if err := json.Unmarshal(value, &job); err != nil {
+			return err
+		}
+		if err := dst_jobs.Put([]byte(id), value); err != nil {
+			return err
+		}
+		if err := dst.Bucket(state_bucket).Put(state_key(job.STAT, id), nil); err != nil {
+			return err
+		}
+
+		if src_samples := src.Bucket(samples_bucket).Bucket([]byte(id)); src_samples != nil {
+			dst_samples, err := dst.Bucket(samples_bucket).CreateBucketIfNotExists([]byte(id))
+			if err != nil {
+				return err
+			}
+			err = src_samples.ForEach(func(k []byte, v []byte) error { return dst_samples.Put(k, v) })
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// events and finish times are keyed by time, so go through them once
+	for _, name := range [][]byte{events_bucket, finished_bucket} {
+		dst_b := dst.Bucket(name)
+		err := src.Bucket(name).ForEach(func(k []byte, v []byte) error {
+			if copying[string(k[8:])] {
+				return dst_b.Put(k, v)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move the given jobs out of the store into a new archive, returning its path
+func archive_jobs(usr_config string, ids []string) (string, error) {
+	if len(ids) == 0 {
+		return "", nil
+	}
+	dir := archive_dir(usr_config)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	archive_path := new_archive_path(dir, time.Now())
+
+	err := with_store(usr_config, true, func(tx *bolt.Tx) error {
+		err := with_store(archive_path, true, func(archive_tx *bolt.Tx) error {
+			return copy_jobs(tx, archive_tx, ids)
+		})
+		if err != nil {
+			return err
+		}
+		return delete_jobs(tx, ids)
+	})
+	return archive_path, err
+}
+
+// the project's archives, most recent first
+func list_archives(usr_config string) ([]archiveInfo, error) {
+	dir := archive_dir(usr_config)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var archives []archiveInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".db") {
+			continue
+		}
+		archive := archiveInfo{id: strings.TrimSuffix(entry.Name(), ".db"), path: dir + entry.Name(), counts: make(map[string]int)}
+		if len(archive.id) >= len(archive_time_format) {
+			archive.time, _ = time.ParseInLocation(archive_time_format, archive.id[:len(archive_time_format)], time.Local)
+		}
+		err := with_store(archive.path, false, func(tx *bolt.Tx) error {
+			return tx.Bucket(state_bucket).ForEach(func(k []byte, _ []byte) error {
+				stat := string(k[:bytes.IndexByte(k, '/')])
+				archive.counts[stat]++
+				archive.total++
+				return nil
+			})
+		})
+		if err != nil {
+			return archives, err
+		}
+		archives = append(archives, archive)
+	}
+	// archives made in the same second are numbered -2, -3 and so on, which
+	// sort by number rather than as text so -10 comes after -9
+	sort.SliceStable(archives, func(i int, j int) bool {
+		a, b := archives[i], archives[j]
+		a_time, a_seq := split_archive_id(a.id)
+		b_time, b_seq := split_archive_id(b.id)
+		if a_time != b_time {
+			return a_time > b_time
+		}
+		return a_seq > b_seq
+	})
+	return archives, nil
+}
+
+// put the jobs of the most recent archive back into the store, returning
+// them and their samples so they can be shown again straight away
+func restore_last_archive(usr_config string) (map[string]recStruct, map[string][]resourceSample, error) {
+	archives, err := list_archives(usr_config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(archives) == 0 {
+		return nil, nil, fmt.Errorf("there is no clear to undo")
+	}
+	archive := archives[0]
+
+	var jobs map[string]recStruct
+	var samples map[string][]resourceSample
+	err = with_store(archive.path, false, func(archive_tx *bolt.Tx) error {
+		var err error
+		if jobs, err = load_jobs(archive_tx); err != nil {
+			return err
+		}
+		if samples, err = load_samples(archive_tx); err != nil {
+			return err
+		}
+		var ids []string
+		for id := range jobs {
+			ids = append(ids, id)
+		}
+		return with_store(usr_config, true, func(tx *bolt.Tx) error {
+			return copy_jobs(archive_tx, tx, ids)
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return jobs, samples, os.Remove(archive.path)
+}
+
+// a one line summary of an archive for listing
+func describe_archive(archive archiveInfo) string {
+	var stats []string
+	for _, stat := range []string{"RUN", "PEND", "DONE", "EXIT"} {
+		if archive.counts[stat] > 0 {
+			stats = append(stats, fmt.Sprintf("%d %s", archive.counts[stat], stat))
+		}
+	}
+	description := fmt.Sprintf("%-20s %s  %d jobs", archive.id, archive.time.Format("2006-01-02 15:04:05"), archive.total)
+	if len(stats) > 0 {
+		description += " (" + strings.Join(stats, ", ") + ")"
+	}
+	return description
+}
+
+// bj archive list [project] and bj archive show <archive> [project]
+func run_archive(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "Usage: bj archive list [project]\n       bj archive show <archive> [project]")
+		return 1
+	}
+	if len(args) < 1 {
+		return usage()
+	}
+
+	project := ""
+	switch {
+	case args[0] == "list" && len(args) <= 2:
+		if len(args) == 2 {
+			project = args[1]
+		}
+	case args[0] == "show" && (len(args) == 2 || len(args) == 3):
+		if len(args) == 3 {
+			project = args[2]
+		}
+	default:
+		return usage()
+	}
+	usr_config := project_store_path(project)
+
+	archives, err := list_archives(usr_config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading archives: "+err.Error())
+		return 1
+	}
+
+	if args[0] == "list" {
+		if len(archives) == 0 {
+			fmt.Println("No archived jobs")
+		}
+		for _, archive := range archives {
+			fmt.Println(describe_archive(archive))
+		}
+		return 0
+	}
+
+	for _, archive := range archives {
+		if archive.id != args[1] {
+			continue
+		}
+		db, err := readJobCache(archive.path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading archive: "+err.Error())
+			return 1
+		}
+		fmt.Println(describe_archive(archive))
+		fmt.Printf("%-14s %-6s %-10s %-18s %-30s %s\n", "JOB ID", "STATUS", "QUEUE", "RAM USAGE", "EXIT REASON", "NAME")
+		ids := make([]string, 0, len(db))
+		for id := range db {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i int, j int) bool { return jobid_less(ids[i], ids[j]) })
+		for _, id := range ids {
+			job := db[id]
+			fmt.Printf("%-14s %-6s %-10s %-18s %-30s %s\n", job.JOBID, job.STAT, job.QUEUE, job.mem_usage(), job.EXIT_REASON, job.JOB_NAME)
+		}
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "No archive "+args[1]+", see bj archive list")
+	return 1
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNewArchivePath(t *testing.T) {
+	dir := t.TempDir() + "/"
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+
+	first := new_archive_path(dir, now)
+	if first != dir+"20240501-123000.db" {
+		t.Errorf("Unexpected archive path %s", first)
+	}
+	ioutil.WriteFile(first, nil, 0644)
+	if second := new_archive_path(dir, now); second != dir+"20240501-123000-2.db" {
+		t.Errorf("Expected a second clear in the same second to get its own archive, got %s", second)
+	}
+}
+
+// Test that archives made in the same second are listed by their number,
+// most recent first, so undo restores the latest clear
+func TestListArchivesOrder(t *testing.T) {
+	usr_config := filepath.Join(t.TempDir(), "history.db")
+	dir := archive_dir(usr_config)
+	os.MkdirAll(dir, 0755)
+	for _, id := range []string{"20240501-122959", "20240501-123000", "20240501-123000-2", "20240501-123000-9", "20240501-123000-10"} {
+		if err := with_store(dir+id+".db", true, func(tx *bolt.Tx) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, err := list_archives(usr_config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, archive := range archives {
+		ids = append(ids, archive.id)
+	}
+	expected := []string{"20240501-123000-10", "20240501-123000-9", "20240501-123000-2", "20240501-123000", "20240501-122959"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected archives in the order %v, got %v", expected, ids)
+	}
+}
+
+func TestClearDatabaseArchivesAndUndo(t *testing.T) {
+	path := retention_store(t)
+
+	if err := clearDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the store to be moved out of place")
+	}
+	archives, err := list_archives(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 || archives[0].total != 4 || archives[0].counts["DONE"] != 2 || archives[0].counts["EXIT"] != 1 {
+		t.Fatalf("Expected one archive of the 4 jobs, got %+v", archives)
+	}
+
+	// a job polled since the clear is kept over the archived record
+	writeDatabase(filepath.Dir(path), path, map[string]recStruct{"4": {JOBID: "4", STAT: "DONE"}}, nil)
+
+	jobs, samples, err := restore_last_archive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 4 || len(samples["1"]) != 1 {
+		t.Errorf("Expected the 4 archived jobs and their samples, got %v %v", jobs, samples)
+	}
+	db, _ := readJobCache(path)
+	if len(db) != 4 || db["4"].STAT != "DONE" {
+		t.Errorf("Expected all 4 jobs restored without replacing job 4, got %v", db)
+	}
+	if archives, _ := list_archives(path); len(archives) != 0 {
+		t.Errorf("Expected the restored archive to be removed, got %v", archives)
+	}
+
+	if _, _, err := restore_last_archive(path); err == nil {
+		t.Error("Expected an error with nothing left to undo")
+	}
+}
+
+func TestClearFinishedJobsArchivesThem(t *testing.T) {
+	path := retention_store(t)
+	db, _ := readJobCache(path)
+
+	if _, err := clear_finished_jobs(path, db, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	archives, _ := list_archives(path)
+	if len(archives) != 1 || archives[0].total != 2 || archives[0].counts["DONE"] != 2 {
+		t.Fatalf("Expected the 2 DONE jobs archived, got %+v", archives)
+	}
+	archived, _ := readJobCache(archives[0].path)
+	if _, ok := archived["1"]; !ok {
+		t.Error("Expected job 1 in the archive")
+	}
+}
+
+func TestRunArchive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(config_dir()+"projects", 0755)
+	path := project_store_path("fqcomp")
+	writeDatabase(config_dir(), path, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}}, nil)
+	if err := clearDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	archives, _ := list_archives(path)
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"list", "fqcomp"}, 0},
+		{[]string{"list"}, 0},
+		{[]string{"show", archives[0].id, "fqcomp"}, 0},
+		{[]string{"show", "20000101-000000", "fqcomp"}, 1},
+		{[]string{"show"}, 1},
+		{[]string{}, 1},
+		{[]string{"delete", "fqcomp"}, 1},
+	}
+	for _, tt := range tests {
+		if got := run_archive(tt.args); got != tt.expected {
+			t.Errorf("run_archive(%v) = %d, expected %d", tt.args, got, tt.expected)
+		}
+	}
+}
@@ -3,17 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
-	"sort"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
+	bolt "go.etcd.io/bbolt"
 )
 
 // initialise variables that need to be global
@@ -24,6 +24,7 @@ var pend_jobs int
 var run_jobs int
 var done_jobs int
 var exit_jobs int
+var susp_jobs int
 var termWidth int
 var termHeight int
 
@@ -34,6 +35,7 @@ var ColorBlue ui.Color
 var ColorRed ui.Color
 var ColorGreen ui.Color
 var ColorAlert ui.Color
+var ColorPredict ui.Color
 
 // initialise the two buttons that need to be global variables
 // (their appearence needs to be modified from inside functions)
@@ -48,6 +50,21 @@ var stats_grid *ui.Grid
 var statusline_grid *ui.Grid
 var statusline *widgets.Paragraph
 
+// JOBIDs in the order they are listed in the job table, the index of the
+// first one scrolled into view, the currently selected job, and the jobs
+// marked for actions on several jobs at once
+var table_jobids []string
+var table_offset int
+var selected_jobid string
+var marked_jobids = make(map[string]bool)
+
+// number of jobs matching the active filter when the table was last drawn
+var filtered_jobs int
+
+// functions posted by background goroutines to be run by the main event loop,
+// so that only the main loop touches the interface and job database
+var ui_updates = make(chan func(), 100)
+
 type recStruct struct {
 	JOBID       string
 	STAT        string
@@ -62,8 +79,22 @@ type recStruct struct {
 	MEMLIMIT    string
 	NTHREADS    string
 	EXIT_CODE   string
+	OUTPUT_FILE string
+	ERROR_FILE  string
+	EXEC_CWD    string
+	JOB_NAME    string
+	MEM         string
+	SWAP        string
+	CPU_USED    string
+	// the project given with bsub -Jd
+	JOB_DESCRIPTION string
+	// the job group given with bsub -g, like /pipeline/sample/step
+	JOB_GROUP string
 }
 
+// fields requested from bjobs -o, the JSON keys of which map onto recStruct
+const bjobs_fields = "jobid stat queue kill_reason dependency exit_reason time_left %complete run_time max_mem memlimit nthreads exit_code output_file error_file exec_cwd job_name mem swap cpu_used job_description job_group"
+
 func (rec recStruct) mem_usage() string {
 	max_mem := rec.MAX_MEM
 	memlimit := rec.MEMLIMIT
@@ -94,7 +125,32 @@ func (rec recStruct) atmemlimit() bool {
 	return atlimit
 }
 
+// memory used as a percentage of the memory limit, false when either is unknown
+func (rec recStruct) mem_percent() (float64, bool) {
+	if rec.MAX_MEM == "" || rec.MEMLIMIT == "" {
+		return 0, false
+	}
+	memlimit := parse_human_sizes(parse_bytes_output(rec.MEMLIMIT))
+	if memlimit == 0 {
+		return 0, false
+	}
+	return parse_human_sizes(parse_bytes_output(rec.MAX_MEM)) / memlimit * 100, true
+}
+
+// percentage of the run limit used, from %COMPLETE values like "0.29% L"
+func (rec recStruct) complete_percent() float64 {
+	completion_perc, _ := strconv.ParseFloat(strings.TrimSpace(strings.Replace(rec.COMPLETE, "% L", "", 1)), 64)
+	return completion_perc
+}
+
+// run time in seconds, from RUN_TIME values like "495 second(s)"
+func (rec recStruct) run_time_seconds() float64 {
+	run_time, _ := strconv.ParseFloat(strings.TrimSpace(strings.Replace(rec.RUN_TIME, "second(s)", "", 1)), 64)
+	return run_time
+}
+
 func parse_bytes_output(bytes_string string) string {
+	bytes_string = strings.ReplaceAll(bytes_string, "Tbytes", "T")
 	bytes_string = strings.ReplaceAll(bytes_string, "Gbytes", "G")
 	bytes_string = strings.ReplaceAll(bytes_string, "Mbytes", "M")
 	bytes_string = strings.ReplaceAll(bytes_string, "Kbytes", "K")
@@ -103,14 +159,33 @@ func parse_bytes_output(bytes_string string) string {
 	return bytes_string
 }
 
+// text for termui widgets that parse [text](style) markup, with square
+// brackets, as in array job names like align[1-100] or job output, swapped
+// for round ones so they can't start or end the markup
+func markup_text(text string) string {
+	return strings.NewReplacer("[", "(", "]", ")").Replace(text)
+}
+
 func parse_human_sizes(human_size_str string) float64 {
-	human_size_str = strings.Replace(human_size_str, "G", "000000000", 1)
-	human_size_str = strings.Replace(human_size_str, "M", "000000", 1)
-	human_size_str = strings.Replace(human_size_str, "K", "000", 1)
 	human_size_str = strings.ReplaceAll(human_size_str, " ", "")
+
+	// multiply by the unit rather than appending zeros, so that
+	// decimal sizes like "80.5G" are read correctly
+	multiplier := 1.0
+	units := []struct {
+		suffix string
+		size   float64
+	}{{"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"K", 1e3}}
+	for _, unit := range units {
+		if strings.HasSuffix(human_size_str, unit.suffix) {
+			human_size_str = strings.TrimSuffix(human_size_str, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
 	machine_readable_size, _ := strconv.ParseFloat(human_size_str, 64)
 
-	return machine_readable_size
+	return machine_readable_size * multiplier
 }
 
 func send_notification_email(projectBool bool, proj_name string) {
@@ -162,19 +237,36 @@ func async_statusline_message(text string, time_ms int) {
 }
 
 func run_bjobs() map[string]recStruct {
+	bj_map, err := run_project_bjobs(proj_name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1) // if problem with bjobs command then stop here
+	}
+	return bj_map
+}
+
+// fetch the jobs of a project, or every job when project is empty. Only
+// exact project names can be given to bjobs, so the jobs of a project
+// pattern are picked out of every job
+func run_project_bjobs(project string) (map[string]recStruct, error) {
 	var bjobs_cmd *exec.Cmd
 
-	if projectBool {
-		bjobs_cmd = exec.Command("bjobs", "-Jd", proj_name, "-a", "-json", "-o", "jobid stat queue kill_reason dependency exit_reason time_left %complete run_time max_mem memlimit nthreads exit_code")
+	if is_project_pattern(project) {
+		jobs, err := run_project_bjobs("")
+		if err != nil {
+			return nil, err
+		}
+		return filter_project_jobs(jobs, project), nil
+	} else if project != "" {
+		bjobs_cmd = exec.Command("bjobs", "-Jd", project, "-a", "-json", "-o", bjobs_fields)
 	} else {
-		bjobs_cmd = exec.Command("bjobs", "-a", "-json", "-o", "jobid stat queue kill_reason dependency exit_reason time_left %complete run_time max_mem memlimit nthreads exit_code")
+		bjobs_cmd = exec.Command("bjobs", "-a", "-json", "-o", bjobs_fields)
 	}
 
 	// 1. fetch current bjobs from shell
 	bjobsJson, err := bjobs_cmd.Output()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1) // if problem with bjobs command then stop here
+		return nil, err
 	}
 
 	// 2. get 'RECORDS' part of JSON
@@ -192,41 +284,84 @@ func run_bjobs() map[string]recStruct {
 		bj_map[bj.JOBID] = bj
 	}
 
-	return bj_map
+	return drop_pruned_jobs(bj_map), nil
 }
 
-func writeDatabase(usr_home string, usr_config string, db map[string]recStruct) {
-	os.MkdirAll(usr_home, 0755)
-	b, err := json.Marshal(db)
+// save the jobs and their resource history to the project's store in one
+// transaction, then note the project's counts in the project index
+func writeDatabase(usr_home string, usr_config string, db map[string]recStruct, history map[string][]resourceSample) {
+	expired, err := save_store(usr_home, usr_config, proj_name, db, history)
+	forget_jobs(db, expired)
 	if err != nil {
-		statusline.Text = "Error in writing cache on exit: " + err.Error()
+		statusline.Text = "Error in writing cache: " + err.Error()
 		ui.Render(statusline_grid)
-		return
 	}
-	err = ioutil.WriteFile(usr_config, b, 0644)
+}
+
+// write a project's jobs and history as writeDatabase does, returning the
+// IDs of the finished jobs the retention limits removed rather than
+// touching the interface, so background tabs can save from a goroutine
+func save_store(usr_home string, usr_config string, project string, db map[string]recStruct, history map[string][]resourceSample) ([]string, error) {
+	os.MkdirAll(filepath.Dir(usr_config), 0755)
+	var expired []string
+	err := with_store(usr_config, true, func(tx *bolt.Tx) error {
+		now := time.Now().Unix()
+		if err := store_jobs(tx, db, now); err != nil {
+			return err
+		}
+		if err := store_samples(tx, history); err != nil {
+			return err
+		}
+		if err := touch_store_meta(tx, project, now); err != nil {
+			return err
+		}
+		var err error
+		expired, err = prune_store(tx, retention_policy(), now)
+		return err
+	})
 	if err != nil {
-		statusline.Text = "Error in writing cache on exit: " + err.Error()
-		ui.Render(statusline_grid)
+		return nil, err
+	}
+
+	if err := update_project_index(usr_home, project, db, time.Now().Unix()); err != nil {
+		return expired, fmt.Errorf("updating project index: %v", err)
 	}
+	return expired, nil
 }
 
 func readSavedDatabase(usr_config string) map[string]recStruct {
-	db := make(map[string]recStruct)
-	if _, err := os.Stat(usr_config); !os.IsNotExist(err) {
-		savedDatabaseJson, err := ioutil.ReadFile(usr_config)
-		if err != nil {
-			statusline.Text = "Error in reading job cache: " + err.Error()
-			ui.Render(statusline_grid)
-			return db
-		}
-		json.Unmarshal([]byte(savedDatabaseJson), &db)
+	db, err := readJobCache(usr_config)
+	if err != nil {
+		statusline.Text = "Error in reading job cache: " + err.Error()
+		ui.Render(statusline_grid)
 	}
 	return db
 }
 
+// read the job cache without reporting errors to the interface, for
+// subcommands that run without it
+func readJobCache(usr_config string) (map[string]recStruct, error) {
+	db := make(map[string]recStruct)
+	if _, err := os.Stat(usr_config); os.IsNotExist(err) {
+		return db, nil
+	}
+	err := with_store(usr_config, false, func(tx *bolt.Tx) error {
+		var err error
+		db, err = load_jobs(tx)
+		return err
+	})
+	return db, err
+}
+
+// move the cache into the project's archive rather than deleting it, so
+// that a mistaken clear can be undone
 func clearDatabase(usr_config string) error {
 	if _, err := os.Stat(usr_config); !os.IsNotExist(err) {
-		return os.Remove(usr_config)
+		dir := archive_dir(usr_config)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return os.Rename(usr_config, new_archive_path(dir, time.Now()))
 	}
 	return nil
 }
@@ -258,7 +393,7 @@ func updateDatabase(db map[string]recStruct, bjobs_map map[string]recStruct) map
 }
 
 // set job counts / statistics line
-func statsGrid(run_jobs int, pend_jobs int, done_jobs int, exit_jobs int) {
+func statsGrid(run_jobs int, pend_jobs int, susp_jobs int, done_jobs int, exit_jobs int) {
 	stats_grid = ui.NewGrid()
 	termWidth, termHeight := ui.TerminalDimensions()
 	stats_grid.SetRect(0, termHeight-3, termWidth, termHeight-2)
@@ -268,6 +403,9 @@ func statsGrid(run_jobs int, pend_jobs int, done_jobs int, exit_jobs int) {
 	pend_jobs_p := widgets.NewParagraph()
 	pend_jobs_p.Text = "Pending: " + strconv.Itoa(pend_jobs)
 	pend_jobs_p.Border = false
+	susp_jobs_p := widgets.NewParagraph()
+	susp_jobs_p.Text = "Suspended: " + strconv.Itoa(susp_jobs)
+	susp_jobs_p.Border = false
 	done_jobs_p := widgets.NewParagraph()
 	done_jobs_p.Text = "Done: " + strconv.Itoa(done_jobs)
 	done_jobs_p.Border = false
@@ -276,16 +414,18 @@ func statsGrid(run_jobs int, pend_jobs int, done_jobs int, exit_jobs int) {
 	exit_jobs_p.Border = false
 
 	stats_grid.Set(ui.NewRow(1.0/1.0,
-		ui.NewCol(1.0/4, run_jobs_p),
-		ui.NewCol(1.0/4, pend_jobs_p),
-		ui.NewCol(1.0/4, done_jobs_p),
-		ui.NewCol(1.0/4, exit_jobs_p)))
+		ui.NewCol(1.0/5, run_jobs_p),
+		ui.NewCol(1.0/5, pend_jobs_p),
+		ui.NewCol(1.0/5, susp_jobs_p),
+		ui.NewCol(1.0/5, done_jobs_p),
+		ui.NewCol(1.0/5, exit_jobs_p)))
 	ui.Render(stats_grid)
 }
 
 func updateJobs(db map[string]recStruct) (map[string]recStruct, bool) {
 	// Fetch and parse output from bjobs command
 	bjobs_map := run_bjobs()
+	sampled := record_resource_samples(resource_history, bjobs_map, time.Now().Unix())
 
 	// Assume no changes initially
 	jobsChanged := false
@@ -298,7 +438,9 @@ func updateJobs(db map[string]recStruct) (map[string]recStruct, bool) {
 			if new_job.STAT != old_job.STAT ||
 				new_job.TIME_LEFT != old_job.TIME_LEFT ||
 				new_job.COMPLETE != old_job.COMPLETE ||
-				new_job.MAX_MEM != old_job.MAX_MEM {
+				new_job.MAX_MEM != old_job.MAX_MEM ||
+				// refresh running jobs whenever their usage was sampled, for the memory trend
+				(sampled && new_job.STAT == "RUN") {
 				// A meaningful change was detected
 				jobsChanged = true
 				db[id] = new_job // Update the job in the database
@@ -347,76 +489,111 @@ func updateJobs(db map[string]recStruct) (map[string]recStruct, bool) {
 	return db, jobsChanged
 }
 
-func redrawUI(db map[string]recStruct, job_table **widgets.Table) {
-	// Clear the current table rows (except the header)
-	(*job_table).Rows = (*job_table).Rows[:1]
-	(*job_table).SetRect(0-1, 0, termWidth+1, termHeight-3)
-
-	// Prepare job lists for UI rendering
-	var all_run_jobs_list []string
-	var exit_jobs_list []string
-	var done_jobs_list []string
-	var remaining_run_jobs_list []string
-
-	// Reset job counts
-	run_jobs = 0
-	pend_jobs = 0
-	done_jobs = 0
-	exit_jobs = 0
+// the state a job is counted under in the stats line, with the ways of
+// being suspended counted together
+func stat_group(job recStruct) string {
+	switch job.STAT {
+	case "USUSP", "SSUSP", "PSUSP":
+		return "SUSP"
+	}
+	return job.STAT
+}
 
-	// Classify jobs and populate lists for display
+// the jobs matching the active filter, every one of which is listed in the
+// table so that pending and suspended jobs can be marked and acted on too,
+// with the matching jobs counted by state. The global counts are set over
+// every job, for the email notification
+func list_jobs(db map[string]recStruct) ([]string, map[string]int) {
+	var listed []string
+	shown := make(map[string]int)
+	counts := make(map[string]int)
+	filtered_jobs = 0
 	for _, bjob := range db {
-		switch bjob.STAT {
-		case "PEND":
-			pend_jobs++
-		case "DONE":
-			done_jobs++
-			done_jobs_list = append(done_jobs_list, bjob.JOBID)
-		case "EXIT":
-			exit_jobs++
-			exit_jobs_list = append(exit_jobs_list, bjob.JOBID)
-		case "RUN":
-			run_jobs++
-			all_run_jobs_list = append(all_run_jobs_list, bjob.JOBID)
+		counts[stat_group(bjob)]++
+		if !active_filter.matches(bjob) {
+			continue
 		}
+		filtered_jobs++
+		shown[stat_group(bjob)]++
+		listed = append(listed, bjob.JOBID)
 	}
+	run_jobs, pend_jobs, susp_jobs, done_jobs, exit_jobs = counts["RUN"], counts["PEND"], counts["SUSP"], counts["DONE"], counts["EXIT"]
+	return listed, shown
+}
 
-	// Sort the job lists for consistent display order
-	sort.Strings(done_jobs_list)
-	sort.Strings(exit_jobs_list)
-	sort.Strings(all_run_jobs_list)
-
-	// Populate job table with RUN jobs
-	for _, id := range all_run_jobs_list {
-		job := db[id]
-		completion_perc, _ := strconv.ParseFloat(strings.Replace(job.COMPLETE, "% L", "", 1), 64)
-		if completion_perc >= 95.0 {
-			(*job_table) = danger_alert((*job_table), db, id, "nearly at time limit")
-		} else if job.atmemlimit() {
-			(*job_table) = danger_alert((*job_table), db, id, "at memory limit")
-		} else {
-			remaining_run_jobs_list = append(remaining_run_jobs_list, id)
+func redrawUI(db map[string]recStruct, job_table **widgets.Table) {
+	// Clear the current table rows (except the header)
+	(*job_table).Rows = (*job_table).Rows[:1]
+	(*job_table).Rows[0] = table_header()
+	(*job_table).SetRect(0-1, tab_bar_height(), termWidth+1, termHeight-3)
+
+	// Prepare the list of jobs for UI rendering
+	listed_jobs_list, shown := list_jobs(db)
+
+	// Flag RUN jobs that are nearing their time or memory limits, or that are
+	// on course to reach them soon going by their recent usage. Predictions are
+	// kept in alerts too so they're pinned to the top with the rest
+	alerts := make(map[string]string)
+	predictions := make(map[string]bool)
+	for _, id := range listed_jobs_list {
+		if alert, predicted := job_alert(db[id], resource_history[id]); alert != "" {
+			alerts[id] = alert
+			predictions[id] = predicted
 		}
 	}
-	sort.Strings(remaining_run_jobs_list)
 
-	// Add remaining RUN jobs to the table
-	for _, id := range remaining_run_jobs_list {
-		(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), strings.Replace(db[id].COMPLETE, " L", "", 1)})
-		(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorGrey, ui.ColorClear)
+	// Order every listed job, but only build rows for those scrolled into
+	// view, so that projects with many thousands of jobs stay responsive
+	table_jobids = order_jobids(db, listed_jobs_list, alerts)
+	visible_rows := table_visible_rows()
+	scroll_to_selection(visible_rows)
+	last_row := table_offset + visible_rows
+	if last_row > len(table_jobids) {
+		last_row = len(table_jobids)
 	}
 
-	// Add EXIT jobs to the table
-	for _, id := range exit_jobs_list {
-		(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), db[id].EXIT_REASON})
-		(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorRed, ui.ColorClear)
+	for _, id := range table_jobids[table_offset:last_row] {
+		if predictions[id] {
+			(*job_table) = predicted_alert((*job_table), db, id, alerts[id])
+			continue
+		}
+		if alert, ok := alerts[id]; ok {
+			(*job_table) = danger_alert((*job_table), db, id, alert)
+			continue
+		}
+
+		switch db[id].STAT {
+		case "RUN":
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, strings.TrimSpace(db[id].mem_usage() + " " + mem_trend(resource_history[id])), strings.Replace(db[id].COMPLETE, " L", "", 1), format_efficiency(db[id].cpu_efficiency()), format_efficiency(db[id].mem_efficiency())})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorGrey, ui.ColorClear)
+		case "EXIT":
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), db[id].EXIT_REASON, format_efficiency(db[id].cpu_efficiency()), format_efficiency(db[id].mem_efficiency())})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorRed, ui.ColorClear)
+		case "DONE":
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), "", format_efficiency(db[id].cpu_efficiency()), format_efficiency(db[id].mem_efficiency())})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorGreen, ui.ColorClear)
+		case "PEND":
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, "", "", "", ""})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorBlue, ui.ColorClear)
+		case "USUSP", "SSUSP", "PSUSP":
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), strings.Replace(db[id].COMPLETE, " L", "", 1), format_efficiency(db[id].cpu_efficiency()), format_efficiency(db[id].mem_efficiency())})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorYellow, ui.ColorClear)
+		default:
+			// every listed job needs a row, whatever state LSF reports it in
+			(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), "", "", ""})
+			(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorGrey, ui.ColorClear)
+		}
 	}
 
-	// Add DONE jobs to the table
-	for _, id := range done_jobs_list {
-		(*job_table).Rows = append((*job_table).Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage()})
-		(*job_table).RowStyles[(len((*job_table).Rows) - 1)] = ui.NewStyle(ColorGreen, ui.ColorClear)
+	if showing_several_projects() {
+		add_project_column(*job_table, db)
 	}
+	highlight_rows(*job_table)
+	projects := 0
+	if showing_several_projects() {
+		projects = count_projects(db, table_jobids)
+	}
+	(*job_table).Title = table_title(last_row, projects)
 
 	// Check if email notifications need to be sent
 	if email_on {
@@ -436,13 +613,229 @@ func redrawUI(db map[string]recStruct, job_table **widgets.Table) {
 	}
 
 	// Update stats and render them
-	statsGrid(run_jobs, pend_jobs, done_jobs, exit_jobs)
+	statsGrid(shown["RUN"], shown["PEND"], shown["SUSP"], shown["DONE"], shown["EXIT"])
 	ui.Render(*job_table) // Display the constructed table
+	render_tab_bar()
 
 	// Render project name if applicable
 	if projectBool {
 		ui.Render(project_name_label)
 	}
+
+	// keep the output viewer and any modal on top of the table when open
+	if output_view != nil {
+		output_view.render()
+	}
+	if pending_view != nil {
+		pending_view.render()
+	}
+	if cluster_view != nil {
+		cluster_view.render()
+	}
+	if detail_view != nil {
+		detail_view.render(db)
+	}
+	if active_modal != nil {
+		active_modal.render()
+	}
+}
+
+// put back what the bottom line should show once a pane or prompt has closed
+func restore_statusline() {
+	switch {
+	case active_prompt != nil:
+		active_prompt.render()
+	case active_modal != nil:
+		active_modal.render()
+	case output_view != nil:
+		show_output_hint()
+	case detail_view != nil:
+		statusline.TextStyle.Fg = ColorGrey
+		statusline.Text = "Previous/next job [↑↓]  Close [Enter] "
+		ui.Render(statusline_grid)
+	case pending_view != nil:
+		statusline.TextStyle.Fg = ColorGrey
+		statusline.Text = "Scroll [↑↓ PgUp PgDn]  Refresh [r]  Close [p] "
+		ui.Render(statusline_grid)
+	case cluster_view != nil:
+		statusline.TextStyle.Fg = ColorGrey
+		statusline.Text = "Refresh [r]  Close [u] "
+		ui.Render(statusline_grid)
+	case active_filter.active():
+		// keep the filter in view while it hides jobs from the table
+		statusline.TextStyle.Fg = ColorBlue
+		statusline.Text = "Filter: " + active_filter.text + "  (" + strconv.Itoa(filtered_jobs) + " matching jobs)   Edit [/]  Clear [Esc]  Quit [q] "
+		ui.Render(statusline_grid)
+	default:
+		statusline.TextStyle.Fg = ColorGrey
+		statusline.Text = ""
+		ui.Render(button_grid)
+	}
+}
+
+// number of job rows that fit in the table below its header
+func table_visible_rows() int {
+	visible_rows := termHeight - 3 - 2 - 1 - tab_bar_height()
+	if visible_rows < 1 {
+		visible_rows = 1
+	}
+	return visible_rows
+}
+
+// scroll the table so the selected job is in view, selecting the first
+// job when the selected one is no longer listed
+func scroll_to_selection(visible_rows int) {
+	selected_row := -1
+	for i, id := range table_jobids {
+		if id == selected_jobid {
+			selected_row = i
+			break
+		}
+	}
+	if selected_row == -1 {
+		selected_jobid = ""
+		selected_row = 0
+		if len(table_jobids) > 0 {
+			selected_jobid = table_jobids[0]
+		}
+	}
+
+	if selected_row < table_offset {
+		table_offset = selected_row
+	} else if selected_row >= table_offset+visible_rows {
+		table_offset = selected_row - visible_rows + 1
+	}
+	if max_offset := len(table_jobids) - visible_rows; table_offset > max_offset {
+		table_offset = max_offset
+	}
+	if table_offset < 0 {
+		table_offset = 0
+	}
+}
+
+// the columns of the job table, with the project of each job when jobs
+// of several projects are shown
+func table_header() []string {
+	if showing_several_projects() {
+		return []string{"JOB ID", "PROJECT", "STATUS", "QUEUE", "RAM USAGE", "%TIME LIMIT", "CPU EFF", "MEM EFF"}
+	}
+	return []string{"JOB ID", "STATUS", "QUEUE", "RAM USAGE", "%TIME LIMIT", "CPU EFF", "MEM EFF"}
+}
+
+// add each visible job's project after its job ID
+func add_project_column(job_table *widgets.Table, db map[string]recStruct) {
+	for i, row := range job_table.Rows[1:] {
+		project := db[table_jobids[table_offset+i]].JOB_DESCRIPTION
+		job_table.Rows[i+1] = append([]string{row[0], project}, row[1:]...)
+	}
+}
+
+// flag the marked jobs and highlight the selected one among the visible rows
+func highlight_rows(job_table *widgets.Table) {
+	for i, row := range job_table.Rows[1:] {
+		id := table_jobids[table_offset+i]
+		if marked_jobids[id] {
+			row[0] = "● " + id
+		}
+		if id == selected_jobid {
+			style := job_table.RowStyles[i+1]
+			style.Modifier = style.Modifier | ui.ModifierReverse
+			job_table.RowStyles[i+1] = style
+		}
+	}
+}
+
+// the table title, showing how many projects the jobs listed come from
+// when there are several, which rows are in view and how they're sorted
+func table_title(last_row int, projects int) string {
+	title := ""
+	if projects > 0 {
+		title = strconv.Itoa(projects) + " projects matching " + proj_name
+	}
+	if len(table_jobids) > table_visible_rows() {
+		if title != "" {
+			title += " | "
+		}
+		title += "Jobs " + strconv.Itoa(table_offset+1) + "-" + strconv.Itoa(last_row) + " of " + strconv.Itoa(len(table_jobids))
+	}
+	if description := sort_description(); description != "" {
+		if title != "" {
+			title += " | "
+		}
+		title += description
+	}
+	if title != "" {
+		title = " " + title + " "
+	}
+	return title
+}
+
+// mark every job listed in the table, or clear the marks when every
+// listed job is already marked
+func toggle_mark_all() {
+	all_marked := len(table_jobids) > 0
+	for _, id := range table_jobids {
+		if !marked_jobids[id] {
+			all_marked = false
+		}
+	}
+
+	if all_marked {
+		marked_jobids = make(map[string]bool)
+		return
+	}
+	for _, id := range table_jobids {
+		marked_jobids[id] = true
+	}
+}
+
+// mark or unmark the selected job for actions on several jobs at once
+func toggle_mark() {
+	if selected_jobid == "" {
+		return
+	}
+	if marked_jobids[selected_jobid] {
+		delete(marked_jobids, selected_jobid)
+	} else {
+		marked_jobids[selected_jobid] = true
+	}
+}
+
+// move the selection up or down the job table by delta rows
+func move_selection(delta int) {
+	if len(table_jobids) == 0 {
+		return
+	}
+	selected_row := 0
+	for i, id := range table_jobids {
+		if id == selected_jobid {
+			selected_row = i
+		}
+	}
+	selected_row += delta
+	if selected_row < 0 {
+		selected_row = 0
+	} else if selected_row >= len(table_jobids) {
+		selected_row = len(table_jobids) - 1
+	}
+	selected_jobid = table_jobids[selected_row]
+}
+
+// why a running job needs attention, nearing its time or memory limit or
+// on course to reach one, with predicted true for the latter
+func job_alert(job recStruct, samples []resourceSample) (alert string, predicted bool) {
+	if job.STAT != "RUN" {
+		return "", false
+	}
+	if job.complete_percent() >= 95.0 {
+		return "nearly at time limit", false
+	} else if job.atmemlimit() {
+		return "at memory limit", false
+	}
+	if prediction := predict_limit(job, samples, config.PredictHorizon*60); prediction != "" {
+		return prediction, true
+	}
+	return "", false
 }
 
 func danger_alert(table1 *widgets.Table, db map[string]recStruct, id string, alert string) *widgets.Table {
@@ -451,18 +844,39 @@ func danger_alert(table1 *widgets.Table, db map[string]recStruct, id string, ale
 	return table1
 }
 
+// a softer warning than danger_alert, for jobs not yet near a limit but
+// heading for one, keeping their memory usage in view
+func predicted_alert(table1 *widgets.Table, db map[string]recStruct, id string, alert string) *widgets.Table {
+	table1.Rows = append(table1.Rows, []string{db[id].JOBID, db[id].STAT, db[id].QUEUE, db[id].mem_usage(), "Job is " + alert})
+	table1.RowStyles[(len(table1.Rows) - 1)] = ui.NewStyle(ColorPredict, ui.ColorClear)
+	return table1
+}
+
 func main() {
 	// initiate default values to be later changed by different user interactions
 	projectBool = false
 	proj_name = ""
-	kill_menu := false
 	email_on = false
 
-	if len(os.Args) > 2 {
-		fmt.Println("Error more than one argument passed, give zero arguments to select all bjobs or one argument to specify a specific project name")
+	subcommand, projects, err := parse_command_line(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error in arguments: " + err.Error())
 		os.Exit(1)
-	} else if len(os.Args) == 2 {
-		proj_name = os.Args[1]
+	}
+	if subcommand != "" {
+		os.Exit(subcommands[subcommand](projects))
+	}
+
+	for _, project := range projects {
+		if err := check_project(project); err != nil {
+			fmt.Println("Error in project pattern " + project + ": " + err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// the first project is shown, and any others opened in tabs behind it
+	if len(projects) > 0 {
+		proj_name = projects[0]
 		projectBool = true
 	}
 
@@ -470,14 +884,13 @@ func main() {
 	ColorRed = ui.ColorRed       // #EC6067 in my terminal colorscheme
 	ColorYellow = ui.ColorYellow // #FDC254
 	ColorBlue = ui.Color(14)
-	ColorGreen = ui.Color(2)   // #89C487
-	ColorGrey = ui.Color(248)  // #979797
-	ColorAlert = ui.Color(203) // #FB454D
+	ColorGreen = ui.Color(2)     // #89C487
+	ColorGrey = ui.Color(248)    // #979797
+	ColorAlert = ui.Color(203)   // #FB454D
+	ColorPredict = ui.Color(215) // #FFAF5F
 
 	// load config and cached job information
-	usr_home, _ := os.UserHomeDir()
-	usr_home = usr_home + "/.config/better-bjobs/"
-	usr_config := usr_home + proj_name + "savedDatabase.json"
+	usr_home := config_dir()
 
 	// start curses terminal interface
 	if err := ui.Init(); err != nil {
@@ -490,18 +903,7 @@ func main() {
 
 	// setup project label
 	project_name_label = widgets.NewParagraph()
-
-	if projectBool {
-		// Truncate only the displayed text if too long
-		display_name := proj_name
-		proj_name_rune := []rune(proj_name)
-		if len(proj_name_rune) > 20 {
-			display_name = string(proj_name_rune[0:20]) + "..."
-		}
-		project_name_label.Text = display_name
-		project_name_label.TextStyle.Fg = ColorBlue
-		project_name_label.SetRect((termWidth - len([]rune(display_name)) - 2), termHeight-6, termWidth+1, termHeight-3)
-	}
+	set_project_label()
 
 	// set statusline to be same location as buttons
 	// so as to hide the buttons when we display a status
@@ -511,8 +913,15 @@ func main() {
 	statusline.Border = false
 	statusline_grid.Set(ui.NewRow(1.0/1.0, statusline))
 
-	// load config with previous session data
+	// load settings and previous session data
+	config = readConfig(usr_home + "config.json")
+	usr_config, err := prepare_project_store(proj_name)
+	if err != nil {
+		statusline.Text = "Error in migrating job cache: " + err.Error()
+		ui.Render(statusline_grid)
+	}
 	db := readSavedDatabase(usr_config)
+	resource_history = readSavedHistory(usr_config)
 
 	// Make grid layout for the buttons
 	// on the bottom of the screen
@@ -555,17 +964,37 @@ func main() {
 	job_table.RowSeparator = false
 
 	// set table headers
-	job_table.Rows = [][]string{[]string{"JOB ID", "STATUS", "QUEUE", "RAM USAGE", "%TIME LIMIT"}}
+	job_table.Rows = [][]string{table_header()}
 	job_table.RowStyles[0] = ui.NewStyle(ColorYellow, ui.ColorClear, ui.ModifierBold)
 
 	// Do initial job fetch and update the database
 	bjobs_map := run_bjobs()
 	db = updateDatabase(db, bjobs_map)
-	writeDatabase(usr_home, usr_config, db)
+	record_resource_samples(resource_history, bjobs_map, time.Now().Unix())
+	writeDatabase(usr_home, usr_config, db, resource_history)
+	project_tabs = []*projectTab{{project: proj_name}}
+	if len(projects) > 1 {
+		for _, project := range projects[1:] {
+			if tab_index(project) == -1 {
+				project_tabs = append(project_tabs, load_tab(usr_home, project))
+			}
+		}
+	}
 	redrawUI(db, &job_table)
 
+	// show a project's jobs in place of those shown, or its tab if it has one
+	show_project := func(project string) {
+		if i := tab_index(project); i != -1 {
+			usr_config, db = show_tab(i, usr_config, db)
+		} else if project != proj_name {
+			usr_config, db = switch_project(usr_home, usr_config, db, project)
+		}
+	}
+
 	// Use a ticker to update job data periodically
 	ticker := time.NewTicker(5 * time.Second).C
+	// and a faster one to follow the output of the job being viewed
+	output_ticker := time.NewTicker(2 * time.Second).C
 
 	// setup keyboard input to process user actions
 	// Main event loop
@@ -573,10 +1002,55 @@ func main() {
 	for {
 		select {
 		case e := <-uiEvents:
+			// typed input and open panes take keys before the job table
+			if active_prompt != nil && e.Type == ui.KeyboardEvent {
+				handle_prompt_event(e)
+				if active_prompt == nil {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+			if active_modal != nil && e.Type == ui.KeyboardEvent {
+				if active_modal.handle_event(e) {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+			if output_view != nil && e.Type == ui.KeyboardEvent {
+				if output_view.handle_event(e) {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+			if pending_view != nil && e.Type == ui.KeyboardEvent {
+				if pending_view.handle_event(e) {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+			if cluster_view != nil && e.Type == ui.KeyboardEvent {
+				if cluster_view.handle_event(e) {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+			if detail_view != nil && e.Type == ui.KeyboardEvent {
+				if detail_view.handle_event(e) {
+					redrawUI(db, &job_table)
+					restore_statusline()
+				}
+				continue
+			}
+
 			switch e.ID {
 			// quit on pressing q or contrl-c
 			case "q", "<C-c>":
-				writeDatabase(usr_home, usr_config, db)
+				writeDatabase(usr_home, usr_config, db, resource_history)
 				return
 
 			case "e":
@@ -597,27 +1071,178 @@ func main() {
 
 			// clear the cache of saved jobs
 			case "c", "<C-l>":
-				statusline.TextStyle.Fg = ColorYellow
-				async_statusline_message("Clearing cached job info", 2)
+				open_clear_menu(usr_config, db, func() {
+					statusline.TextStyle.Fg = ColorYellow
+					async_statusline_message("Clearing cached job info", 2)
+
+					// Clear the database file
+					if err := clearDatabase(usr_config); err != nil {
+						statusline.Text = "Error clearing cache: " + err.Error()
+						ui.Render(statusline_grid)
+					}
+
+					// Clear the in-memory db and fetch fresh jobs
+					db = make(map[string]recStruct)
+					resource_history = make(map[string][]resourceSample)
+					marked_jobids = make(map[string]bool)
+					recent_jobs := run_bjobs()
+
+					// Replace db with only the recent jobs (don't use updateDatabase which preserves existing jobs)
+					for id, job := range recent_jobs {
+						db[id] = job
+					}
+				})
+
+			// move the selection through the job table
+			case "<Up>":
+				move_selection(-1)
+				redrawUI(db, &job_table)
+			case "<Down>":
+				move_selection(1)
+				redrawUI(db, &job_table)
+			case "<PageUp>":
+				move_selection(-table_visible_rows())
+				redrawUI(db, &job_table)
+			case "<PageDown>":
+				move_selection(table_visible_rows())
+				redrawUI(db, &job_table)
+			case "<Home>":
+				move_selection(-len(table_jobids))
+				redrawUI(db, &job_table)
+			case "<End>":
+				move_selection(len(table_jobids))
+				redrawUI(db, &job_table)
 
-				// Clear the database file
-				if err := clearDatabase(usr_config); err != nil {
-					statusline.Text = "Error clearing cache: " + err.Error()
-					ui.Render(statusline_grid)
+			// mark the selected job and move on to the next
+			case "<Space>":
+				toggle_mark()
+				move_selection(1)
+				redrawUI(db, &job_table)
+
+			// mark every listed job, or unmark them all if they already are
+			case "A":
+				toggle_mark_all()
+				redrawUI(db, &job_table)
+
+			// suspend, resume, requeue or kill the marked or selected jobs
+			case "a":
+				if targets := action_targets(); len(targets) > 0 {
+					open_action_menu("Job actions", job_actions, targets, db)
+				} else {
+					async_statusline_message("Error: no job selected", 2)
+				}
+
+			// sort by the next column, reverse the sort, or pin alerts to the top
+			case "s":
+				cycle_sort_column()
+				redrawUI(db, &job_table)
+			case "S":
+				sort_descending = !sort_descending
+				redrawUI(db, &job_table)
+			case "P":
+				pin_alerts = !pin_alerts
+				redrawUI(db, &job_table)
+
+			// clear the filter, or the marks when no filter is applied
+			case "<Escape>":
+				if active_filter.active() {
+					active_filter = jobFilter{}
+				} else {
+					marked_jobids = make(map[string]bool)
+				}
+				redrawUI(db, &job_table)
+				restore_statusline()
+
+			// filter the table, applying the filter as it is typed
+			case "/":
+				previous_filter := active_filter
+				filter_prompt := open_prompt("Filter: ", active_filter.text, func(text string) {}, func() {
+					active_filter = previous_filter
+				})
+				filter_prompt.on_change = func(text string) {
+					filter, err := parse_filter(text)
+					if err != nil {
+						filter_prompt.note = err.Error()
+						return
+					}
+					filter_prompt.note = ""
+					active_filter = filter
+					redrawUI(db, &job_table)
 				}
 
-				// Clear the in-memory db and fetch fresh jobs
-				db = make(map[string]recStruct)
-				recent_jobs := run_bjobs()
+			// kill, requeue, modify, switch or export the marked jobs
+			case "b":
+				if len(marked_jobids) > 0 {
+					open_action_menu("Bulk actions", bulk_actions, action_targets(), db)
+				} else {
+					async_statusline_message("Error: no jobs marked, mark jobs with [Space] or all listed jobs with [A]", 3)
+				}
 
-				// Replace db with only the recent jobs (don't use updateDatabase which preserves existing jobs)
-				for id, job := range recent_jobs {
-					db[id] = job
+			// show every field and the resource history of the selected job
+			case "<Enter>":
+				if selected_jobid != "" {
+					open_detail_view()
+					redrawUI(db, &job_table)
+					restore_statusline()
+				} else {
+					async_statusline_message("Error: no job selected", 2)
 				}
 
-				// Immediately redraw after clearing
+			// show why pending jobs are waiting
+			case "p":
+				open_pending_view()
+				restore_statusline()
+
+			// summarise how efficiently finished jobs used what they requested
+			case "E":
+				open_efficiency_view(db)
+
+			// show how busy each queue and the cluster's hosts are
+			case "u":
+				open_cluster_view()
+				restore_statusline()
+
+			// switch to another project's jobs, or to its tab if it has one
+			case "J":
+				open_project_picker(show_project)
+
+			// summarise every project with jobs, to drill into one of them
+			case "O":
+				open_overview(show_project)
+
+			// open a project in a new tab, move between tabs or close one
+			case "T":
+				open_project_picker(func(project string) {
+					usr_config, db = open_tab(usr_home, project, usr_config, db)
+				})
+			case "<Tab>":
+				usr_config, db = show_tab((active_tab+1)%len(project_tabs), usr_config, db)
+				redrawUI(db, &job_table)
+			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+				if i, _ := strconv.Atoi(e.ID); i <= len(project_tabs) {
+					usr_config, db = show_tab(i-1, usr_config, db)
+					redrawUI(db, &job_table)
+				}
+			case "X":
+				usr_config, db = close_tab(usr_home, usr_config, db)
 				redrawUI(db, &job_table)
 
+			// show the tree of job groups, to filter the table to one of them
+			case "G":
+				open_group_view(db)
+
+			// show how the project's jobs depend on each other
+			case "g":
+				open_dependency_view(db)
+
+			// view the output of the selected job
+			case "o":
+				if job, ok := db[selected_jobid]; ok {
+					open_output_view(job)
+				} else {
+					async_statusline_message("Error: no job selected", 2)
+				}
+
 			// re-render all elements on resizing terminal window
 			case "<Resize>":
 				payload := e.Payload.(ui.Resize)
@@ -626,58 +1251,48 @@ func main() {
 				redrawUI(db, &job_table)
 
 			case "k":
-				if run_jobs > 0 || pend_jobs > 0 {
-					// specify that only project ids will be killed if we have a project subview
-					projectText := ""
-					if projectBool {
-						projectText = " for project " + proj_name
-					}
-
-					kill_menu = true
-					statusline.TextStyle.Fg = ColorRed
-					async_statusline_message("Are you sure you want to kill all unfinished bjobs"+projectText+"? [Yn] ", 5)
-					redrawUI(db, &job_table)
+				if kill_running {
+					async_statusline_message("Error: jobs are already being killed", 2)
+				} else if len(active_jobids(db)) > 0 {
+					confirm_kill_all(db)
 				} else {
 					statusline.TextStyle.Fg = ColorRed
-					async_statusline_message("Error: no active jobs (running or pending)", 5)
-				}
-
-			// manage yes and no prompts initiated by other cases
-			case "y":
-				if kill_menu {
-					// if we say yes to all-kill menu then alert user
-					for jobid, _ := range db {
-						cmd := exec.Command("bkill", jobid)
-						_, err := cmd.Output()
-						if err != nil {
-							statusline.Text = "Error: " + err.Error()
-							ui.Render(statusline_grid)
-						}
-					}
-					kill_menu = false
-					redrawUI(db, &job_table)
+					async_statusline_message("Error: no active jobs (running, pending or suspended)", 5)
 				}
+			}
 
-			case "n":
-				if kill_menu {
-					// if we say no to all-kill menu then reset statusline and put back buttons
-					kill_menu = false
-					statusline.TextStyle.Fg = ColorGrey
-					statusline.Text = ""
-					ui.Render(statusline_grid)
-					ui.Render(button_grid)
-					redrawUI(db, &job_table)
-				}
+		// apply updates posted by background work, such as kill progress
+		case update := <-ui_updates:
+			update()
+			if active_modal == nil && active_prompt == nil && !kill_running {
+				redrawUI(db, &job_table)
+				restore_statusline()
 			}
 
 		case <-ticker:
 			// Periodically update the jobs and redraw only if needed
 			db, jobsChanged := updateJobs(db)
+			if pending_view != nil {
+				pending_view.load()
+			}
+			if cluster_view != nil && time.Since(cluster_view.loaded) >= cluster_refresh_interval {
+				cluster_view.load()
+			}
+			refresh_background_tabs(usr_home)
 			if jobsChanged {
 				// Write database to disk to persist changes
-				writeDatabase(usr_home, usr_config, db)
+				writeDatabase(usr_home, usr_config, db, resource_history)
 				redrawUI(db, &job_table)
 			}
+
+		case <-output_ticker:
+			if output_view != nil {
+				// pick up the job's latest status so finished jobs switch from bpeek to their files
+				if job, ok := db[output_view.job.JOBID]; ok {
+					output_view.job = job
+				}
+				output_view.load()
+			}
 		}
 	}
 }
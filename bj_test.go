@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 )
 
@@ -394,7 +395,7 @@ func TestDatabasePersistence(t *testing.T) {
 	testFile := filepath.Join(tempDir, "test_database.json")
 
 	// Test writeDatabase
-	writeDatabase(tempDir, testFile, db)
+	writeDatabase(tempDir, testFile, db, nil)
 
 	// Verify file was created
 	if _, err := os.Stat(testFile); os.IsNotExist(err) {
@@ -482,6 +483,25 @@ func TestMemUsage(t *testing.T) {
 	}
 }
 
+// Test reading bjobs memory sizes, including decimal and terabyte sizes
+func TestParseHumanSizes(t *testing.T) {
+	cases := map[string]float64{
+		"293 G":       293e9,
+		"80.5 Gbytes": 80.5e9,
+		"512 Mbytes":  512e6,
+		"1.5 Kbytes":  1500,
+		"2 Tbytes":    2e12,
+		"1.25T":       1.25e12,
+		"4096":        4096,
+		"":            0,
+	}
+	for size, expected := range cases {
+		if result := parse_human_sizes(parse_bytes_output(size)); result != expected {
+			t.Errorf("Expected %q to be read as %.0f bytes, got %.0f", size, expected, result)
+		}
+	}
+}
+
 // Test memory limit detection
 func TestAtMemLimit(t *testing.T) {
 	// Test job at memory limit (90%+ usage)
@@ -537,7 +557,7 @@ func TestClearDatabaseFunctionality(t *testing.T) {
 	testFile := filepath.Join(tempDir, "test_database.json")
 
 	// Write initial database to file
-	writeDatabase(tempDir, testFile, db)
+	writeDatabase(tempDir, testFile, db, nil)
 
 	// Verify initial state
 	if len(db) != 3 {
@@ -626,7 +646,7 @@ func TestOldClearDatabaseLogicWasBuggy(t *testing.T) {
 	testFile := filepath.Join(tempDir, "test_database.json")
 
 	// Write initial database to file
-	writeDatabase(tempDir, testFile, db)
+	writeDatabase(tempDir, testFile, db, nil)
 
 	// Simulate the OLD (buggy) clear database logic from bj.go
 	// This replicates the exact OLD logic that was buggy
@@ -831,3 +851,65 @@ func TestKillJobsWithPendingJobs(t *testing.T) {
 		t.Error("Kill jobs should be allowed when there are both running and pending jobs")
 	}
 }
+
+// Test that the table scrolls to keep the selected job in view
+func TestScrollToSelection(t *testing.T) {
+	defer func() {
+		table_jobids = nil
+		table_offset = 0
+		selected_jobid = ""
+	}()
+
+	table_jobids = nil
+	for i := 0; i < 100; i++ {
+		table_jobids = append(table_jobids, strconv.Itoa(i))
+	}
+	table_offset = 0
+
+	// selecting below the visible rows scrolls down just enough to show it
+	selected_jobid = "50"
+	scroll_to_selection(10)
+	if table_offset != 41 {
+		t.Errorf("Expected offset 41 to show row 50 at the bottom, got %d", table_offset)
+	}
+
+	// selecting above scrolls up to put it at the top
+	selected_jobid = "5"
+	scroll_to_selection(10)
+	if table_offset != 5 {
+		t.Errorf("Expected offset 5 to show row 5 at the top, got %d", table_offset)
+	}
+
+	// a selected job that's no longer listed falls back to the first job
+	selected_jobid = "missing"
+	scroll_to_selection(10)
+	if selected_jobid != "0" || table_offset != 0 {
+		t.Errorf("Expected selection to fall back to the first job, got %s at offset %d", selected_jobid, table_offset)
+	}
+
+	// the offset never leaves empty rows at the bottom
+	table_jobids = table_jobids[:5]
+	table_offset = 3
+	scroll_to_selection(10)
+	if table_offset != 0 {
+		t.Errorf("Expected offset 0 when every job fits, got %d", table_offset)
+	}
+}
+
+// Benchmark ordering a large project's cached jobs for the table
+func BenchmarkOrderJobids(b *testing.B) {
+	db := make(map[string]recStruct)
+	var ids []string
+	for i := 0; i < 50000; i++ {
+		id := strconv.Itoa(100000 + i)
+		db[id] = recStruct{JOBID: id, STAT: "RUN", QUEUE: "normal", MAX_MEM: strconv.Itoa(i%100) + " Gbytes", MEMLIMIT: "100 G"}
+		ids = append(ids, id)
+	}
+	defer func() { sort_index = 0 }()
+
+	sort_index = 2 // memory
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		order_jobids(db, ids, nil)
+	}
+}
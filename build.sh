@@ -2,5 +2,7 @@
 
 # set environment variables that specify host to compile for
 # this allows me to compile the linux versions from my mac
+# and record the version in the caches bj writes
 env GOOS=linux GOARCH=amd64 \
-	go build bj.go
+	go build -ldflags "-X main.bj_version=$(git describe --tags --always 2>/dev/null || echo dev)" \
+	-o bj $(ls *.go | grep -v '_test.go$')
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// how often the open cluster panel is refreshed, less often than the job
+// table as bhosts can be slow on large clusters
+const cluster_refresh_interval = 30 * time.Second
+
+// queueLoad is one queue's line of bqueues output
+type queueLoad struct {
+	name   string
+	status string
+	max    string // slot limit, "-" when unlimited
+	njobs  int
+	pend   int
+	run    int
+	susp   int
+}
+
+// hostCounts is how many hosts bhosts reports as open, full or closed
+type hostCounts struct {
+	open   int
+	full   int
+	closed int
+}
+
+// userLimits is our line of busers output
+type userLimits struct {
+	max   string // slot limit, "-" when unlimited
+	njobs int
+	pend  int
+	run   int
+}
+
+// clusterPanel charts how busy each queue is alongside the state of the
+// hosts and our own slot limits, to help decide where to submit
+type clusterPanel struct {
+	chart  *widgets.StackedBarChart
+	pane   *widgets.Paragraph
+	queues []queueLoad
+	hosts  hostCounts
+	user   userLimits
+	errs   []string
+	loaded time.Time
+	// the LSF commands are running in the background, and whether they
+	// have finished once
+	loading bool
+	fetched bool
+}
+
+// the cluster panel currently open, nil when the job table is showing
+var cluster_view *clusterPanel
+
+func open_cluster_view() {
+	cluster_view = &clusterPanel{
+		chart: widgets.NewStackedBarChart(),
+		pane:  widgets.NewParagraph(),
+	}
+	cluster_view.chart.Title = " Jobs per queue: running, pending "
+	cluster_view.chart.TitleStyle.Fg = ColorYellow
+	cluster_view.chart.BorderStyle.Fg = ColorBlue
+	cluster_view.chart.BarColors = []ui.Color{ColorGreen, ColorYellow}
+	cluster_view.chart.NumStyles = []ui.Style{ui.NewStyle(ui.ColorBlack), ui.NewStyle(ui.ColorBlack)}
+	cluster_view.chart.LabelStyles = []ui.Style{ui.NewStyle(ColorGrey)}
+	cluster_view.chart.BarWidth = 8
+	cluster_view.chart.NumFormatter = func(n float64) string { return strconv.Itoa(int(n)) }
+	cluster_view.pane.Title = " Cluster "
+	cluster_view.pane.TitleStyle.Fg = ColorYellow
+	cluster_view.pane.BorderStyle.Fg = ColorBlue
+	cluster_view.pane.WrapText = false
+	cluster_view.load()
+	cluster_view.render()
+}
+
+// run the LSF commands in the background, as bhosts can be slow on large
+// clusters, with the panel drawn again once they've finished. A load still
+// running is left to finish rather than starting another
+func (cv *clusterPanel) load() {
+	if cv.loading {
+		return
+	}
+	cv.loading = true
+	cv.loaded = time.Now()
+	go func() {
+		var latest clusterPanel
+		latest.fetch()
+		ui_updates <- func() {
+			cv.queues, cv.hosts, cv.user, cv.errs = latest.queues, latest.hosts, latest.user, latest.errs
+			cv.loading, cv.fetched = false, true
+		}
+	}()
+}
+
+// fill in the queues, hosts and our limits from bqueues, bhosts and busers
+func (cv *clusterPanel) fetch() {
+	if out, err := exec.Command("bqueues").Output(); err != nil && len(out) == 0 {
+		cv.errs = append(cv.errs, "bqueues: "+err.Error())
+	} else {
+		cv.queues = parse_bqueues(string(out))
+	}
+	if out, err := exec.Command("bhosts").Output(); err != nil && len(out) == 0 {
+		cv.errs = append(cv.errs, "bhosts: "+err.Error())
+	} else {
+		cv.hosts = parse_bhosts(string(out))
+	}
+	if out, err := exec.Command("busers").Output(); err != nil && len(out) == 0 {
+		cv.errs = append(cv.errs, "busers: "+err.Error())
+	} else {
+		cv.user = parse_busers(string(out))
+	}
+}
+
+// split the whitespace aligned tables LSF commands print into a map of
+// header to value for each line
+func parse_columns(output string) []map[string]string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	header := strings.Fields(lines[0])
+	var rows []map[string]string
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		row := make(map[string]string)
+		for i, name := range header {
+			row[name] = fields[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func parse_bqueues(output string) []queueLoad {
+	var queues []queueLoad
+	for _, row := range parse_columns(output) {
+		queue := queueLoad{name: row["QUEUE_NAME"], status: row["STATUS"], max: row["MAX"]}
+		queue.njobs, _ = strconv.Atoi(row["NJOBS"])
+		queue.pend, _ = strconv.Atoi(row["PEND"])
+		queue.run, _ = strconv.Atoi(row["RUN"])
+		queue.susp, _ = strconv.Atoi(row["SUSP"])
+		queues = append(queues, queue)
+	}
+	// busiest queues first, as they're the ones worth comparing
+	sort.SliceStable(queues, func(i int, j int) bool { return queues[i].njobs > queues[j].njobs })
+	return queues
+}
+
+func parse_bhosts(output string) hostCounts {
+	var hosts hostCounts
+	for _, row := range parse_columns(output) {
+		switch status := row["STATUS"]; {
+		case status == "ok":
+			hosts.open++
+		case status == "closed_Full":
+			hosts.full++
+		default:
+			// closed by an admin, unavailable, unreachable or otherwise not taking jobs
+			hosts.closed++
+		}
+	}
+	return hosts
+}
+
+func parse_busers(output string) userLimits {
+	var user userLimits
+	rows := parse_columns(output)
+	if len(rows) == 0 {
+		return user
+	}
+	row := rows[0]
+	user.max = row["MAX"]
+	user.njobs, _ = strconv.Atoi(row["NJOBS"])
+	user.pend, _ = strconv.Atoi(row["PEND"])
+	user.run, _ = strconv.Atoi(row["RUN"])
+	return user
+}
+
+func (cv *clusterPanel) render() {
+	// the chart takes the top half, the queue table and limits the rest
+	chart_bottom := (termHeight - 3) / 2
+	cv.chart.SetRect(0, 0, termWidth, chart_bottom)
+	cv.pane.SetRect(0, chart_bottom, termWidth, termHeight-3)
+
+	// only as many queues as there's room for bars, and only those with jobs
+	max_bars := (termWidth - 2) / (cv.chart.BarWidth + cv.chart.BarGap)
+	cv.chart.Data = nil
+	cv.chart.Labels = nil
+	for _, queue := range cv.queues {
+		if len(cv.chart.Data) >= max_bars || queue.njobs == 0 {
+			continue
+		}
+		cv.chart.Data = append(cv.chart.Data, []float64{float64(queue.run), float64(queue.pend)})
+		cv.chart.Labels = append(cv.chart.Labels, queue.name)
+	}
+	// termui divides by the tallest bar, so give it a floor when every queue is empty
+	cv.chart.MaxVal = 0
+	if len(cv.chart.Data) == 0 {
+		cv.chart.MaxVal = 1
+	}
+
+	var lines []string
+	if !cv.fetched {
+		lines = append(lines, "Fetching queues and hosts...")
+	}
+	for _, err := range cv.errs {
+		lines = append(lines, "Error fetching "+err)
+	}
+	lines = append(lines, fmt.Sprintf("[Hosts](fg:yellow,mod:bold)  %d open, %d full, %d closed", cv.hosts.open, cv.hosts.full, cv.hosts.closed))
+	lines = append(lines, fmt.Sprintf("[Our jobs](fg:yellow,mod:bold)  %d running, %d pending of a %s slot limit", cv.user.run, cv.user.pend, limit_description(cv.user.max)))
+	lines = append(lines, "", fmt.Sprintf("%-16s %-14s %6s %7s %7s %7s", "QUEUE", "STATUS", "SLOTS", "RUN", "PEND", "SUSP"))
+	for _, queue := range cv.queues {
+		lines = append(lines, fmt.Sprintf("%-16s %-14s %6s %7d %7d %7d", queue.name, queue.status, queue.max, queue.run, queue.pend, queue.susp))
+	}
+
+	// drop what doesn't fit rather than letting termui wrap it
+	if max_lines := termHeight - 3 - chart_bottom - 2; len(lines) > max_lines && max_lines > 0 {
+		lines = lines[:max_lines]
+	}
+	cv.pane.Text = strings.Join(lines, "\n")
+	ui.Render(cv.chart, cv.pane)
+}
+
+// LSF shows "-" for no limit
+func limit_description(limit string) string {
+	if limit == "" || limit == "-" {
+		return "unlimited"
+	}
+	return limit
+}
+
+// handle a key press while the panel is open, returning true when it
+// has been closed and the job table underneath needs redrawing
+func (cv *clusterPanel) handle_event(e ui.Event) bool {
+	switch e.ID {
+	case "u", "q", "<Escape>":
+		cluster_view = nil
+		return true
+	case "r":
+		cv.load()
+	}
+	return false
+}
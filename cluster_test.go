@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func read_fixture(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseBqueues(t *testing.T) {
+	queues := parse_bqueues(read_fixture(t, "test/data/bqueues.txt"))
+	if len(queues) != 5 {
+		t.Fatalf("Expected 5 queues, got %d", len(queues))
+	}
+
+	// busiest first
+	expected_order := []string{"normal", "long", "hugemem", "basement", "yesterday"}
+	for i, name := range expected_order {
+		if queues[i].name != name {
+			t.Errorf("Expected queue %d to be %s, got %s", i, name, queues[i].name)
+		}
+	}
+
+	long := queues[1]
+	if long.status != "Open:Active" || long.max != "2000" || long.njobs != 360 || long.pend != 300 || long.run != 58 || long.susp != 2 {
+		t.Errorf("Unexpected long queue %+v", long)
+	}
+	if queues[0].max != "-" {
+		t.Errorf("Expected normal queue to have no slot limit, got %s", queues[0].max)
+	}
+}
+
+func TestParseBhosts(t *testing.T) {
+	hosts := parse_bhosts(read_fixture(t, "test/data/bhosts.txt"))
+	if hosts != (hostCounts{open: 2, full: 2, closed: 2}) {
+		t.Errorf("Expected 2 open, 2 full and 2 closed hosts, got %+v", hosts)
+	}
+}
+
+func TestParseBusers(t *testing.T) {
+	user := parse_busers(read_fixture(t, "test/data/busers.txt"))
+	if user != (userLimits{max: "500", njobs: 190, pend: 60, run: 128}) {
+		t.Errorf("Unexpected user limits %+v", user)
+	}
+	if user := parse_busers(""); user != (userLimits{}) {
+		t.Errorf("Expected no limits from empty output, got %+v", user)
+	}
+}
+
+func TestParseColumnsSkipsMalformedLines(t *testing.T) {
+	rows := parse_columns("NAME STATUS\nnode-1 ok\nNo hosts found\n")
+	if len(rows) != 1 || rows[0]["NAME"] != "node-1" || rows[0]["STATUS"] != "ok" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+}
+
+func TestLimitDescription(t *testing.T) {
+	if limit_description("-") != "unlimited" || limit_description("") != "unlimited" || limit_description("500") != "500" {
+		t.Error("Unexpected limit description")
+	}
+}
+
+// Test that the panel is loaded in the background, with its results
+// applied through ui_updates and only one load running at once
+func TestClusterPanelLoadsInBackground(t *testing.T) {
+	cv := &clusterPanel{}
+	cv.load()
+	if !cv.loading {
+		t.Fatal("Expected the panel to be loading")
+	}
+	loaded := cv.loaded
+	cv.load()
+	if cv.loaded != loaded {
+		t.Error("Expected a second load to wait for the first to finish")
+	}
+
+	select {
+	case update := <-ui_updates:
+		update()
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the results to be posted to ui_updates")
+	}
+	if cv.loading || !cv.fetched {
+		t.Errorf("Expected the load to have finished, got loading %v fetched %v", cv.loading, cv.fetched)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// subcommands run in place of the interface when given as the first
+// argument, printing their output and returning an exit code
+var subcommands = map[string]func(args []string) int{
+	"report":    run_report,
+	"archive":   run_archive,
+	"projects":  run_projects,
+	"recommend": run_recommend,
+}
+
+// split the command line into a subcommand and its arguments, or into
+// the projects to watch when it doesn't start with one. Projects named like
+// a subcommand can be given after "--" or with "-p", e.g. bj -- report
+func parse_command_line(args []string) (string, []string, error) {
+	if len(args) > 0 {
+		if _, ok := subcommands[args[0]]; ok {
+			return args[0], args[1:], nil
+		}
+	}
+	var projects []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--":
+			return "", append(projects, args[i+1:]...), nil
+		case "-p":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("-p needs a project name")
+			}
+			i++
+			projects = append(projects, args[i])
+		default:
+			projects = append(projects, args[i])
+		}
+	}
+	return "", projects, nil
+}
+
+// load the cached jobs of a project, or of every job when project is
+// empty, updated with what bjobs currently reports
+func load_project_jobs(project string) (map[string]recStruct, error) {
+	proj_name = project
+	projectBool = project != ""
+	usr_config, err := prepare_project_store(proj_name)
+	if err != nil {
+		return nil, err
+	}
+	db, err := readJobCache(usr_config)
+	if err != nil {
+		return db, err
+	}
+	return updateDatabase(db, run_bjobs()), nil
+}
+
+// bj report efficiency [project]
+func run_report(args []string) int {
+	if len(args) < 1 || len(args) > 2 || args[0] != "efficiency" {
+		fmt.Fprintln(os.Stderr, "Usage: bj report efficiency [project]")
+		return 1
+	}
+	project := ""
+	if len(args) == 2 {
+		project = args[1]
+	}
+
+	db, err := load_project_jobs(project)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error in reading job cache: "+err.Error())
+		return 1
+	}
+	for _, line := range efficiency_report_lines(db) {
+		fmt.Println(line)
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test splitting the command line into a subcommand or the projects to watch
+func TestParseCommandLine(t *testing.T) {
+	cases := []struct {
+		args       []string
+		subcommand string
+		rest       []string
+	}{
+		{nil, "", nil},
+		{[]string{"report", "efficiency", "fqcomp"}, "report", []string{"efficiency", "fqcomp"}},
+		{[]string{"fqcomp", "alignment"}, "", []string{"fqcomp", "alignment"}},
+		// projects named like subcommands
+		{[]string{"--", "report"}, "", []string{"report"}},
+		{[]string{"fqcomp", "--", "archive", "-p"}, "", []string{"fqcomp", "archive", "-p"}},
+		{[]string{"-p", "projects", "-p", "recommend"}, "", []string{"projects", "recommend"}},
+	}
+	for _, c := range cases {
+		subcommand, rest, err := parse_command_line(c.args)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", c.args, err)
+		}
+		if subcommand != c.subcommand || !reflect.DeepEqual(rest, c.rest) {
+			t.Errorf("Expected %v to give %q %v, got %q %v", c.args, c.subcommand, c.rest, subcommand, rest)
+		}
+	}
+
+	if _, _, err := parse_command_line([]string{"-p"}); err == nil {
+		t.Error("Expected an error for -p without a project")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// bjConfig holds the user's settings from config.json in the config
+// directory, any setting left out keeps its default
+type bjConfig struct {
+	// warn about jobs projected to reach their memory or run limit
+	// within this many minutes, 0 turns the predictions off
+	PredictHorizon int `json:"predict_horizon_minutes"`
+	// days finished jobs are kept in the cache, exited jobs being kept
+	// longer as they're more often looked back on, 0 keeping them forever
+	DoneRetentionDays int `json:"done_retention_days"`
+	ExitRetentionDays int `json:"exit_retention_days"`
+	// most finished jobs kept per project, 0 for no limit
+	MaxFinishedJobs int `json:"max_finished_jobs"`
+}
+
+var config = default_config()
+
+// the directory holding the settings and the caches of each project
+func config_dir() string {
+	usr_home, _ := os.UserHomeDir()
+	return usr_home + "/.config/better-bjobs/"
+}
+
+func default_config() bjConfig {
+	return bjConfig{
+		PredictHorizon: 30,
+		// finished jobs are kept until the user sets a limit, as pruning
+		// deletes them rather than archiving them
+		DoneRetentionDays: 0,
+		ExitRetentionDays: 0,
+		MaxFinishedJobs:   0,
+	}
+}
+
+func readConfig(usr_config_file string) bjConfig {
+	cfg := default_config()
+	if _, err := os.Stat(usr_config_file); !os.IsNotExist(err) {
+		configJson, err := ioutil.ReadFile(usr_config_file)
+		if err != nil {
+			statusline.Text = "Error in reading config: " + err.Error()
+			ui.Render(statusline_grid)
+			return cfg
+		}
+		if err := json.Unmarshal(configJson, &cfg); err != nil {
+			statusline.Text = "Error in reading config: " + err.Error()
+			ui.Render(statusline_grid)
+			return default_config()
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	if cfg := readConfig(filepath.Join(dir, "config.json")); cfg != default_config() {
+		t.Errorf("Expected defaults without a config file, got %+v", cfg)
+	}
+
+	config_file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(config_file, []byte(`{"predict_horizon_minutes": 60}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := readConfig(config_file); cfg.PredictHorizon != 60 {
+		t.Errorf("Expected a horizon of 60 minutes, got %d", cfg.PredictHorizon)
+	}
+
+	// settings left out keep their defaults
+	if err := ioutil.WriteFile(config_file, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := readConfig(config_file); cfg.PredictHorizon != default_config().PredictHorizon {
+		t.Errorf("Expected the default horizon, got %d", cfg.PredictHorizon)
+	}
+}
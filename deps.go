@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// depNode is part of a parsed LSF dependency expression: an operator
+// joining other nodes, or a single condition like done(123)
+type depNode struct {
+	op       string // "&&", "||", "!", or empty for a condition
+	children []*depNode
+	kind     string   // the condition, e.g. done, ended or exit
+	args     []string // the condition's arguments, the job first
+}
+
+// depEdge is a dependency of one job on another
+type depEdge struct {
+	from string // the upstream job
+	to   string // the job waiting on it
+	kind string
+}
+
+// depParser is a recursive descent parser over a dependency expression
+type depParser struct {
+	text string
+	pos  int
+}
+
+// parse an expression like `done(123) && (ended("align*") || exit(456, > 1))`
+func parse_dependency(expression string) (*depNode, error) {
+	p := &depParser{text: expression}
+	node, err := p.parse_or()
+	if err != nil {
+		return nil, err
+	}
+	p.skip_spaces()
+	if p.pos != len(p.text) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.text[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+func (p *depParser) skip_spaces() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t' || p.text[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// consume token if the expression continues with it
+func (p *depParser) accept(token string) bool {
+	p.skip_spaces()
+	if strings.HasPrefix(p.text[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *depParser) parse_or() (*depNode, error) {
+	left, err := p.parse_and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parse_and()
+		if err != nil {
+			return nil, err
+		}
+		left = &depNode{op: "||", children: []*depNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *depParser) parse_and() (*depNode, error) {
+	left, err := p.parse_not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parse_not()
+		if err != nil {
+			return nil, err
+		}
+		left = &depNode{op: "&&", children: []*depNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *depParser) parse_not() (*depNode, error) {
+	if p.accept("!") {
+		child, err := p.parse_not()
+		if err != nil {
+			return nil, err
+		}
+		return &depNode{op: "!", children: []*depNode{child}}, nil
+	}
+	if p.accept("(") {
+		node, err := p.parse_or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, errors.New("missing closing bracket")
+		}
+		return node, nil
+	}
+	return p.parse_condition()
+}
+
+// a condition like done(123), or a bare job ID or name which LSF treats as done()
+func (p *depParser) parse_condition() (*depNode, error) {
+	p.skip_spaces()
+	start := p.pos
+	for p.pos < len(p.text) && !strings.ContainsRune("()&|! \t\n", rune(p.text[p.pos])) {
+		if p.text[p.pos] == '"' || p.text[p.pos] == '\'' {
+			quote := p.text[p.pos]
+			p.pos++
+			for p.pos < len(p.text) && p.text[p.pos] != quote {
+				p.pos++
+			}
+		}
+		// keep array indexes like 123[4] as part of the job
+		if p.pos < len(p.text) && p.text[p.pos] == '[' {
+			for p.pos < len(p.text) && p.text[p.pos] != ']' {
+				p.pos++
+			}
+		}
+		p.pos++
+	}
+	if p.pos > len(p.text) {
+		p.pos = len(p.text)
+	}
+	word := p.text[start:p.pos]
+	if word == "" {
+		return nil, fmt.Errorf("expected a condition at position %d", start)
+	}
+
+	if !p.accept("(") {
+		return &depNode{kind: "done", args: []string{unquote(word)}}, nil
+	}
+
+	// the arguments run to the matching bracket, split on commas
+	depth := 1
+	arg_start := p.pos
+	var args []string
+	for ; p.pos < len(p.text); p.pos++ {
+		switch p.text[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 1 {
+				args = append(args, unquote(p.text[arg_start:p.pos]))
+				arg_start = p.pos + 1
+			}
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("missing closing bracket for " + word)
+	}
+	args = append(args, unquote(p.text[arg_start:p.pos]))
+	p.pos++
+	return &depNode{kind: strings.ToLower(word), args: args}, nil
+}
+
+func unquote(text string) string {
+	return strings.Trim(strings.TrimSpace(text), `"'`)
+}
+
+// the conditions of an expression, in the order they appear
+func (node *depNode) conditions() []*depNode {
+	if node.op == "" {
+		return []*depNode{node}
+	}
+	var conditions []*depNode
+	for _, child := range node.children {
+		conditions = append(conditions, child.conditions()...)
+	}
+	return conditions
+}
+
+// the jobs in db a dependency argument refers to: a job ID (matching every
+// element of an array), or a job name which may contain * wildcards
+func resolve_dependency_target(db map[string]recStruct, target string) []string {
+	var ids []string
+	if _, ok := db[target]; ok {
+		return []string{target}
+	}
+	for id, job := range db {
+		if strings.HasPrefix(id, target+"[") {
+			ids = append(ids, id)
+		} else if job.JOB_NAME != "" {
+			if matched, _ := path.Match(target, job.JOB_NAME); matched {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i int, j int) bool { return jobid_less(ids[i], ids[j]) })
+	return ids
+}
+
+// whether a condition is met (1), can no longer be met (-1), or is
+// still undecided (0) given the current status of the jobs it refers to
+func (node *depNode) evaluate(db map[string]recStruct) int {
+	switch node.op {
+	case "!":
+		return -node.children[0].evaluate(db)
+	case "&&":
+		result := 1
+		for _, child := range node.children {
+			if child_result := child.evaluate(db); child_result < result {
+				result = child_result
+			}
+		}
+		return result
+	case "||":
+		result := -1
+		for _, child := range node.children {
+			if child_result := child.evaluate(db); child_result > result {
+				result = child_result
+			}
+		}
+		return result
+	}
+
+	if len(node.args) == 0 {
+		return 0
+	}
+	ids := resolve_dependency_target(db, node.args[0])
+	if len(ids) == 0 {
+		return 0
+	}
+
+	// a condition on several jobs is met once it is met for all of them
+	result := 1
+	for _, id := range ids {
+		job_result := condition_result(node.kind, db[id].STAT)
+		if job_result < result {
+			result = job_result
+		}
+	}
+	return result
+}
+
+// the result of a single job condition given the upstream job's status
+func condition_result(kind string, stat string) int {
+	finished := stat == "DONE" || stat == "EXIT"
+	switch kind {
+	case "done", "post_done":
+		if stat == "DONE" {
+			return 1
+		} else if stat == "EXIT" {
+			return -1
+		}
+	case "exit", "post_err":
+		if stat == "EXIT" {
+			return 1
+		} else if stat == "DONE" {
+			return -1
+		}
+	case "ended":
+		if finished {
+			return 1
+		}
+	case "started":
+		if stat != "PEND" && stat != "PSUSP" && stat != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// every dependency between jobs in db, upstream job first
+func dependency_edges(db map[string]recStruct) []depEdge {
+	var edges []depEdge
+	for id, job := range db {
+		expression, err := job_dependency(job)
+		if expression == nil || err != nil {
+			continue
+		}
+		for _, condition := range expression.conditions() {
+			if len(condition.args) == 0 {
+				continue
+			}
+			for _, upstream := range resolve_dependency_target(db, condition.args[0]) {
+				if upstream != id {
+					edges = append(edges, depEdge{from: upstream, to: id, kind: condition.kind})
+				}
+			}
+		}
+	}
+	sort.Slice(edges, func(i int, j int) bool {
+		if edges[i].from != edges[j].from {
+			return jobid_less(edges[i].from, edges[j].from)
+		}
+		return jobid_less(edges[i].to, edges[j].to)
+	})
+	return edges
+}
+
+// the parsed dependency of a job, nil when it has none
+func job_dependency(job recStruct) (*depNode, error) {
+	expression := strings.TrimSpace(job.DEPENDENCY)
+	if expression == "" || expression == "-" {
+		return nil, nil
+	}
+	return parse_dependency(expression)
+}
+
+// whether a job is waiting on a dependency that can never be met, usually
+// because an upstream job it needed to finish successfully exited
+func is_blocked(db map[string]recStruct, job recStruct) bool {
+	if job.STAT != "PEND" && job.STAT != "PSUSP" {
+		return false
+	}
+	expression, err := job_dependency(job)
+	return err == nil && expression != nil && expression.evaluate(db) == -1
+}
+
+// an ASCII tree of the project's dependencies, each upstream job followed
+// by the jobs waiting on it
+func dependency_tree_lines(db map[string]recStruct) []string {
+	edges := dependency_edges(db)
+	if len(edges) == 0 {
+		return []string{"No jobs in this project depend on each other"}
+	}
+
+	children := make(map[string][]string)
+	has_parent := make(map[string]bool)
+	for _, edge := range edges {
+		if len(children[edge.from]) == 0 || children[edge.from][len(children[edge.from])-1] != edge.to {
+			children[edge.from] = append(children[edge.from], edge.to)
+		}
+		has_parent[edge.to] = true
+	}
+
+	var roots []string
+	for id := range children {
+		if !has_parent[id] {
+			roots = append(roots, id)
+		}
+	}
+	sort.Slice(roots, func(i int, j int) bool { return jobid_less(roots[i], roots[j]) })
+	// jobs in a cycle have no root, so start from any left over once the
+	// trees from every root have been drawn
+	for _, edge := range edges {
+		roots = append(roots, edge.from)
+	}
+
+	var lines []string
+	shown := make(map[string]bool)
+	var add_node func(id string, prefix string, branch string, child_prefix string)
+	add_node = func(id string, prefix string, branch string, child_prefix string) {
+		if shown[id] {
+			lines = append(lines, prefix+branch+id+" (shown above)")
+			return
+		}
+		shown[id] = true
+		lines = append(lines, prefix+branch+dependency_label(db, id))
+		for i, child := range children[id] {
+			if i == len(children[id])-1 {
+				add_node(child, prefix+child_prefix, "└─ ", "   ")
+			} else {
+				add_node(child, prefix+child_prefix, "├─ ", "│  ")
+			}
+		}
+	}
+	for _, root := range roots {
+		if !shown[root] {
+			add_node(root, "", "", "")
+		}
+	}
+
+	unconnected := 0
+	for id := range db {
+		if !shown[id] && !has_parent[id] {
+			unconnected++
+		}
+	}
+	if unconnected > 0 {
+		lines = append(lines, "", fmt.Sprintf("%d jobs have no dependencies", unconnected))
+	}
+	return lines
+}
+
+// a job's line in the dependency tree, coloured by its status
+func dependency_label(db map[string]recStruct, id string) string {
+	job := db[id]
+	label := id
+	if job.JOB_NAME != "" {
+		label += " " + job.JOB_NAME
+	}
+	label = markup_text(label + " " + job.STAT)
+
+	colour := "fg:white"
+	switch job.STAT {
+	case "PEND":
+		colour = "fg:yellow"
+	case "DONE":
+		colour = "fg:green"
+	case "EXIT":
+		colour = "fg:red"
+	}
+	if is_blocked(db, job) {
+		return "[" + label + " - blocked by an EXIT upstream](fg:red,mod:underline)"
+	}
+	return "[" + label + "](" + colour + ")"
+}
+
+// the project's dependencies as a Graphviz DOT graph
+func dependency_dot(db map[string]recStruct) string {
+	var dot strings.Builder
+	dot.WriteString("digraph dependencies {\n")
+	dot.WriteString("  rankdir=LR;\n  node [shape=box, style=filled, fillcolor=white];\n")
+
+	colours := map[string]string{"RUN": "lightblue", "PEND": "lightyellow", "DONE": "palegreen", "EXIT": "salmon"}
+	edges := dependency_edges(db)
+	nodes := make(map[string]bool)
+	for _, edge := range edges {
+		nodes[edge.from] = true
+		nodes[edge.to] = true
+	}
+	var ids []string
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i int, j int) bool { return jobid_less(ids[i], ids[j]) })
+
+	for _, id := range ids {
+		job := db[id]
+		// DOT reads \n in a label as a line break
+		label := id
+		if job.JOB_NAME != "" {
+			label += `\n` + job.JOB_NAME
+		}
+		label += `\n` + job.STAT
+		attributes := "label=" + dot_quote(label) + ", fillcolor=" + dot_quote(colours[job.STAT])
+		if is_blocked(db, job) {
+			attributes += `, color="red", penwidth=3`
+		}
+		dot.WriteString("  " + dot_quote(id) + " [" + attributes + "];\n")
+	}
+	for _, edge := range edges {
+		dot.WriteString("  " + dot_quote(edge.from) + " -> " + dot_quote(edge.to) + " [label=" + dot_quote(edge.kind) + "];\n")
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// quote a DOT identifier or label, escaping any quotes within it
+func dot_quote(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, `\"`) + `"`
+}
+
+// show the dependency tree over the job table, with the option of
+// exporting it as a DOT file
+func open_dependency_view(db map[string]recStruct) {
+	m := open_modal("Job dependencies", dependency_tree_lines(db), "Export DOT [x]  Close [g] ", func(key string) bool {
+		switch key {
+		case "x":
+			open_prompt("Export DOT graph to file: ", "bj_dependencies.dot", func(text string) {
+				if err := ioutil.WriteFile(text, []byte(dependency_dot(db)), 0644); err != nil {
+					statusline.TextStyle.Fg = ColorRed
+					async_statusline_message("Error exporting graph: "+err.Error(), 3)
+					return
+				}
+				async_statusline_message("Exported dependency graph to "+text, 3)
+			}, nil)
+			return true
+		case "g", "q", "<Escape>":
+			return true
+		}
+		return false
+	})
+	m.full = true
+	m.render()
+}
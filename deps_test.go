@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// a small pipeline: two alignments, a merge waiting on both, and a report
+// waiting on the merge
+func createDependencyTestDatabase() map[string]recStruct {
+	return map[string]recStruct{
+		"100":    {JOBID: "100", JOB_NAME: "align_1", STAT: "DONE"},
+		"101":    {JOBID: "101", JOB_NAME: "align_2", STAT: "EXIT"},
+		"102":    {JOBID: "102", JOB_NAME: "merge", STAT: "PEND", DEPENDENCY: `done("align_*")`},
+		"103":    {JOBID: "103", JOB_NAME: "report", STAT: "PEND", DEPENDENCY: "done(102) || exit(101)"},
+		"104":    {JOBID: "104", JOB_NAME: "cleanup", STAT: "PEND", DEPENDENCY: "ended(100) && ended(101)"},
+		"105[1]": {JOBID: "105[1]", JOB_NAME: "qc[1]", STAT: "RUN"},
+		"105[2]": {JOBID: "105[2]", JOB_NAME: "qc[2]", STAT: "DONE"},
+		"106":    {JOBID: "106", JOB_NAME: "summary", STAT: "PEND", DEPENDENCY: "done(105)"},
+		"107":    {JOBID: "107", STAT: "RUN"},
+	}
+}
+
+// Test parsing LSF dependency expressions
+func TestParseDependency(t *testing.T) {
+	node, err := parse_dependency(`done(123) && (ended("align*") || !exit(456, > 1))`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing expression: %v", err)
+	}
+	if node.op != "&&" {
+		t.Errorf("Expected && at the top of the expression, got %q", node.op)
+	}
+
+	conditions := node.conditions()
+	if len(conditions) != 3 {
+		t.Fatalf("Expected 3 conditions, got %d", len(conditions))
+	}
+	if conditions[1].kind != "ended" || conditions[1].args[0] != "align*" {
+		t.Errorf("Expected quoted job name to be unquoted, got %s(%v)", conditions[1].kind, conditions[1].args)
+	}
+	if len(conditions[2].args) != 2 || conditions[2].args[1] != "> 1" {
+		t.Errorf("Expected exit condition to keep its exit code argument, got %v", conditions[2].args)
+	}
+
+	// a bare job ID means done()
+	node, err = parse_dependency("123[4]")
+	if err != nil || node.kind != "done" || node.args[0] != "123[4]" {
+		t.Errorf("Expected bare array job to be done(123[4]), got %v %v", node, err)
+	}
+
+	for _, expression := range []string{"done(123", "done(1) &&", "(done(1)"} {
+		if _, err := parse_dependency(expression); err == nil {
+			t.Errorf("Expected an error parsing %q", expression)
+		}
+	}
+}
+
+// Test finding jobs that can never start because an upstream job exited
+func TestIsBlocked(t *testing.T) {
+	db := createDependencyTestDatabase()
+
+	expected := map[string]bool{
+		"102": true,  // needs both alignments done, but one exited
+		"103": false, // exit(101) is already met
+		"104": false, // both alignments have ended
+		"106": false, // one element of the array is still running
+		"100": false, // finished jobs are never blocked
+	}
+	for id, blocked := range expected {
+		if is_blocked(db, db[id]) != blocked {
+			t.Errorf("Expected job %s blocked to be %v", id, blocked)
+		}
+	}
+}
+
+// Test the edges drawn between jobs, including name wildcards and arrays
+func TestDependencyEdges(t *testing.T) {
+	edges := dependency_edges(createDependencyTestDatabase())
+
+	var described []string
+	for _, edge := range edges {
+		described = append(described, edge.from+"->"+edge.to)
+	}
+	expected := "100->102,100->104,101->102,101->103,101->104,102->103,105[1]->106,105[2]->106"
+	if strings.Join(described, ",") != expected {
+		t.Errorf("Expected edges %s, got %s", expected, strings.Join(described, ","))
+	}
+}
+
+// Test the ASCII tree and DOT export of the dependencies
+func TestDependencyTreeAndDot(t *testing.T) {
+	db := createDependencyTestDatabase()
+
+	lines := dependency_tree_lines(db)
+	tree := strings.Join(lines, "\n")
+	if !strings.HasPrefix(lines[0], "[100 align_1 DONE]") {
+		t.Errorf("Expected the tree to start at the first upstream job, got %q", lines[0])
+	}
+	if !strings.Contains(tree, "102 merge PEND - blocked by an EXIT upstream") {
+		t.Error("Expected the blocked merge job to be highlighted")
+	}
+	if !strings.Contains(tree, "(shown above)") {
+		t.Error("Expected jobs with several upstream jobs to be shown once in full")
+	}
+	if lines[len(lines)-1] != "1 jobs have no dependencies" {
+		t.Errorf("Expected unconnected job count, got %q", lines[len(lines)-1])
+	}
+
+	dot := dependency_dot(db)
+	if !strings.HasPrefix(dot, "digraph dependencies {") || !strings.Contains(dot, `"101" -> "102" [label="done"];`) {
+		t.Errorf("Unexpected DOT output:\n%s", dot)
+	}
+	if !strings.Contains(dot, `"102" [label="102\nmerge\nPEND", fillcolor="lightyellow", color="red", penwidth=3];`) {
+		t.Errorf("Expected the blocked job to be outlined in red:\n%s", dot)
+	}
+
+	empty := dependency_tree_lines(map[string]recStruct{"1": {JOBID: "1"}})
+	if len(empty) != 1 {
+		t.Errorf("Expected a single line when there are no dependencies, got %v", empty)
+	}
+}
+
+// Test that brackets in job names don't break the tree's colour markup
+func TestDependencyLabelEscapesBrackets(t *testing.T) {
+	db := map[string]recStruct{
+		"300[2]": {JOBID: "300[2]", JOB_NAME: "align[1-100]", STAT: "EXIT"},
+		"301":    {JOBID: "301", JOB_NAME: "odd]name[", STAT: "RUN"},
+	}
+	cases := map[string]string{
+		"300[2]": "300(2) align(1-100) EXIT",
+		"301":    "301 odd)name( RUN",
+	}
+	for id, expected := range cases {
+		var text strings.Builder
+		for _, cell := range ui.ParseStyles(dependency_label(db, id), ui.NewStyle(ui.ColorWhite)) {
+			text.WriteRune(cell.Rune)
+		}
+		if text.String() != expected {
+			t.Errorf("Expected label %q to be shown as %q, got %q", id, expected, text.String())
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// detailView shows every field of the selected job above sparklines of
+// its memory, swap and CPU usage over time
+type detailView struct {
+	info   *widgets.Paragraph
+	sparks *widgets.SparklineGroup
+	mem    *widgets.Sparkline
+	swap   *widgets.Sparkline
+	cpu    *widgets.Sparkline
+}
+
+// the detail pane currently open, nil when the job table is showing
+var detail_view *detailView
+
+func open_detail_view() {
+	dv := &detailView{
+		info: widgets.NewParagraph(),
+		mem:  widgets.NewSparkline(),
+		swap: widgets.NewSparkline(),
+		cpu:  widgets.NewSparkline(),
+	}
+	dv.info.BorderStyle.Fg = ColorBlue
+	dv.info.TitleStyle.Fg = ColorYellow
+	dv.info.WrapText = false
+	dv.mem.LineColor = ColorYellow
+	dv.swap.LineColor = ColorRed
+	dv.cpu.LineColor = ColorGreen
+	dv.sparks = widgets.NewSparklineGroup(dv.mem, dv.swap, dv.cpu)
+	dv.sparks.Title = " Resource usage over time "
+	dv.sparks.TitleStyle.Fg = ColorYellow
+	dv.sparks.BorderStyle.Fg = ColorBlue
+	detail_view = dv
+}
+
+// a size in bytes in the same short form as the table, e.g. "12.3G"
+func format_bytes(size float64) string {
+	units := []struct {
+		suffix string
+		size   float64
+	}{{"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"K", 1e3}}
+	for _, unit := range units {
+		if size >= unit.size {
+			return strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintf("%.1f", size/unit.size), "0"), ".") + unit.suffix
+		}
+	}
+	return fmt.Sprintf("%.0fB", size)
+}
+
+// the last width values, which is as many as a sparkline can draw
+func last_values(values []float64, width int) []float64 {
+	if width > 0 && len(values) > width {
+		return values[len(values)-width:]
+	}
+	return values
+}
+
+// the job's fields as "NAME: value" lines, skipping those that are empty
+func job_detail_lines(job recStruct) []string {
+	fields := [][2]string{
+		{"JOB ID", job.JOBID}, {"NAME", job.JOB_NAME}, {"STATUS", job.STAT}, {"QUEUE", job.QUEUE},
+		{"RUN TIME", job.RUN_TIME}, {"%COMPLETE", job.COMPLETE}, {"TIME LEFT", job.TIME_LEFT},
+		{"MEMORY", job.MEM}, {"MAX MEMORY", job.MAX_MEM}, {"MEMORY LIMIT", job.MEMLIMIT}, {"SWAP", job.SWAP},
+		{"CPU USED", job.CPU_USED}, {"THREADS", job.NTHREADS}, {"EXIT CODE", job.EXIT_CODE},
+		{"EXIT REASON", job.EXIT_REASON}, {"KILL REASON", job.KILL_REASON}, {"DEPENDENCY", job.DEPENDENCY},
+		{"OUTPUT FILE", job.OUTPUT_FILE}, {"ERROR FILE", job.ERROR_FILE}, {"DIRECTORY", job.EXEC_CWD},
+	}
+	fields = append(fields, [2]string{"CPU EFFICIENCY", format_efficiency(job.cpu_efficiency())}, [2]string{"MEM EFFICIENCY", format_efficiency(job.mem_efficiency())})
+	var lines []string
+	for _, field := range fields {
+		if field[1] != "" {
+			lines = append(lines, fmt.Sprintf("%-15s %s", field[0]+":", field[1]))
+		}
+	}
+	return lines
+}
+
+func (dv *detailView) render(db map[string]recStruct) {
+	job, ok := db[selected_jobid]
+	if !ok {
+		detail_view = nil
+		return
+	}
+	lines := job_detail_lines(job)
+
+	// fields take the top of the pane, leaving at least 9 rows for sparklines
+	info_height := len(lines) + 2
+	if max_height := termHeight - 3 - 9; info_height > max_height {
+		info_height = max_height
+	}
+	if info_height < 3 {
+		info_height = 3
+	}
+	dv.info.Title = " Job " + job.JOBID + " "
+	dv.info.Text = strings.Join(lines, "\n")
+	dv.info.SetRect(0, 0, termWidth, info_height)
+	dv.sparks.SetRect(0, info_height, termWidth, termHeight-3)
+
+	samples := resource_history[job.JOBID]
+	width := termWidth - 2
+	var mem, swap []float64
+	for _, sample := range samples {
+		mem = append(mem, sample.Mem)
+		swap = append(swap, sample.Swap)
+	}
+	cpu := cpu_rates(samples)
+
+	// the pane is reused between jobs and redraws, so scales set for the
+	// last job shown mustn't carry over
+	dv.mem.MaxVal, dv.swap.MaxVal, dv.cpu.MaxVal = 0, 0, 0
+
+	if len(samples) == 0 {
+		dv.mem.Title = "No resource samples yet, these are taken while the job runs"
+	} else {
+		latest := samples[len(samples)-1]
+		dv.mem.Title = "Memory " + format_bytes(latest.Mem)
+		// draw memory against the limit so the height shows how close the job is to it
+		if memlimit := parse_human_sizes(parse_bytes_output(job.MEMLIMIT)); memlimit > 0 {
+			dv.mem.Title += " of " + format_bytes(memlimit) + " limit"
+			dv.mem.MaxVal = memlimit
+		}
+		dv.mem.Title += " " + mem_trend(samples)
+		dv.swap.Title = "Swap " + format_bytes(latest.Swap)
+		dv.cpu.Title = "CPU cores in use"
+		if len(cpu) > 0 {
+			dv.cpu.Title += fmt.Sprintf(" %.1f", cpu[len(cpu)-1])
+		}
+	}
+
+	for _, line := range []struct {
+		sparkline *widgets.Sparkline
+		data      []float64
+	}{{dv.mem, mem}, {dv.swap, swap}, {dv.cpu, cpu}} {
+		line.sparkline.Data = scale_sparkline_data(last_values(line.data, width), &line.sparkline.MaxVal)
+	}
+
+	ui.Render(dv.info, dv.sparks)
+}
+
+// the values a sparkline draws, never above its max_value as termui draws
+// a cell for every multiple of it a value reaches. Sparklines can't scale
+// empty or all-zero data, so those are given a floor
+func scale_sparkline_data(data []float64, max_value *float64) []float64 {
+	scaled := []float64{0}
+	if len(data) > 0 {
+		scaled = make([]float64, len(data))
+		copy(scaled, data)
+	}
+	if data_max, _ := ui.GetMaxFloat64FromSlice(scaled); data_max == 0 && *max_value == 0 {
+		*max_value = 1
+	}
+	if *max_value > 0 {
+		for i, value := range scaled {
+			if value > *max_value {
+				scaled[i] = *max_value
+			}
+		}
+	}
+	return scaled
+}
+
+// handle a key press while the pane is open, returning true when it
+// has been closed or another job selected, so the interface needs redrawing
+func (dv *detailView) handle_event(e ui.Event) bool {
+	switch e.ID {
+	case "<Enter>", "q", "<Escape>":
+		detail_view = nil
+		return true
+	case "<Up>":
+		move_selection(-1)
+		return true
+	case "<Down>":
+		move_selection(1)
+		return true
+	}
+	return false
+}
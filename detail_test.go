@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test that sparkline data is given a floor when empty or all zero, and
+// kept within the limit it's drawn against
+func TestScaleSparklineData(t *testing.T) {
+	max_value := 0.0
+	if data := scale_sparkline_data(nil, &max_value); !reflect.DeepEqual(data, []float64{0}) || max_value != 1 {
+		t.Errorf("Expected a zero with a floor of 1 for no data, got %v with max %v", data, max_value)
+	}
+
+	// a scale left from another job isn't used, as the caller resets it
+	max_value = 0
+	if data := scale_sparkline_data([]float64{0, 2e6}, &max_value); !reflect.DeepEqual(data, []float64{0, 2e6}) || max_value != 0 {
+		t.Errorf("Expected real data to be scaled by termui, got %v with max %v", data, max_value)
+	}
+
+	max_value = 10
+	original := []float64{5, 20}
+	if data := scale_sparkline_data(original, &max_value); !reflect.DeepEqual(data, []float64{5, 10}) || max_value != 10 {
+		t.Errorf("Expected values over the limit to be clamped to it, got %v with max %v", data, max_value)
+	}
+	if original[1] != 20 {
+		t.Error("Expected the samples themselves to be left alone")
+	}
+}
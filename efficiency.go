@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jobs using less than this percentage of the CPU or memory they asked
+// for are reported as over-requested
+const low_efficiency = 50.0
+
+// CPU time used as a percentage of what the job's threads could have
+// used over its run time, false when either is unknown
+func (rec recStruct) cpu_efficiency() (float64, bool) {
+	nthreads, _ := strconv.ParseFloat(strings.TrimSpace(rec.NTHREADS), 64)
+	run_time := rec.run_time_seconds()
+	if nthreads <= 0 || run_time <= 0 || rec.CPU_USED == "" {
+		return 0, false
+	}
+	return rec.cpu_seconds() / (run_time * nthreads) * 100, true
+}
+
+// peak memory as a percentage of the memory limit
+func (rec recStruct) mem_efficiency() (float64, bool) {
+	return rec.mem_percent()
+}
+
+// an efficiency for a table cell, blank when it's unknown
+func format_efficiency(efficiency float64, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(efficiency, 'f', 0, 64) + "%"
+}
+
+// whether a finished job used much less CPU or memory than it requested
+func (rec recStruct) over_requested() bool {
+	if rec.STAT != "DONE" && rec.STAT != "EXIT" {
+		return false
+	}
+	cpu, cpu_ok := rec.cpu_efficiency()
+	mem, mem_ok := rec.mem_efficiency()
+	return (cpu_ok && cpu < low_efficiency) || (mem_ok && mem < low_efficiency)
+}
+
+// efficiencySummary totals the efficiency of a project's finished jobs
+type efficiencySummary struct {
+	jobs     int
+	cpu_jobs int // jobs with a known CPU efficiency
+	mem_jobs int // jobs with a known memory efficiency
+	cpu_mean float64
+	mem_mean float64
+	over_cpu int
+	over_mem int
+	// memory requested and peak memory used, summed over the jobs, in bytes
+	mem_requested float64
+	mem_used      float64
+}
+
+func summarise_efficiency(db map[string]recStruct) efficiencySummary {
+	var summary efficiencySummary
+	for _, job := range db {
+		if job.STAT != "DONE" && job.STAT != "EXIT" {
+			continue
+		}
+		summary.jobs++
+		if cpu, ok := job.cpu_efficiency(); ok {
+			summary.cpu_jobs++
+			summary.cpu_mean += cpu
+			if cpu < low_efficiency {
+				summary.over_cpu++
+			}
+		}
+		if mem, ok := job.mem_efficiency(); ok {
+			summary.mem_jobs++
+			summary.mem_mean += mem
+			if mem < low_efficiency {
+				summary.over_mem++
+			}
+			summary.mem_requested += parse_human_sizes(parse_bytes_output(job.MEMLIMIT))
+			summary.mem_used += parse_human_sizes(parse_bytes_output(job.MAX_MEM))
+		}
+	}
+	if summary.cpu_jobs > 0 {
+		summary.cpu_mean /= float64(summary.cpu_jobs)
+	}
+	if summary.mem_jobs > 0 {
+		summary.mem_mean /= float64(summary.mem_jobs)
+	}
+	return summary
+}
+
+// finished jobs using much less than they requested, least efficient first
+func over_requested_jobs(db map[string]recStruct) []recStruct {
+	var jobs []recStruct
+	for _, job := range db {
+		if job.over_requested() {
+			jobs = append(jobs, job)
+		}
+	}
+	// order by the lower of the two efficiencies
+	lowest := func(job recStruct) float64 {
+		lowest := 100.0
+		if cpu, ok := job.cpu_efficiency(); ok && cpu < lowest {
+			lowest = cpu
+		}
+		if mem, ok := job.mem_efficiency(); ok && mem < lowest {
+			lowest = mem
+		}
+		return lowest
+	}
+	sort.SliceStable(jobs, func(i int, j int) bool {
+		if lowest(jobs[i]) != lowest(jobs[j]) {
+			return lowest(jobs[i]) < lowest(jobs[j])
+		}
+		return jobid_less(jobs[i].JOBID, jobs[j].JOBID)
+	})
+	return jobs
+}
+
+// the efficiency summary and over-requested jobs as plain text lines, shared
+// by the summary screen and `bj report efficiency`
+func efficiency_report_lines(db map[string]recStruct) []string {
+	summary := summarise_efficiency(db)
+	if summary.jobs == 0 {
+		return []string{"No finished jobs to report on"}
+	}
+
+	lines := []string{
+		fmt.Sprintf("Finished jobs:       %d", summary.jobs),
+		fmt.Sprintf("Mean CPU efficiency: %s of %d jobs", format_efficiency(summary.cpu_mean, summary.cpu_jobs > 0), summary.cpu_jobs),
+		fmt.Sprintf("Mean mem efficiency: %s of %d jobs", format_efficiency(summary.mem_mean, summary.mem_jobs > 0), summary.mem_jobs),
+		fmt.Sprintf("Memory requested:    %s, peak use %s", format_bytes(summary.mem_requested), format_bytes(summary.mem_used)),
+		fmt.Sprintf("Over-requested:      %d jobs used under %.0f%% of their CPU, %d under %.0f%% of their memory", summary.over_cpu, low_efficiency, summary.over_mem, low_efficiency),
+	}
+
+	jobs := over_requested_jobs(db)
+	if len(jobs) > 0 {
+		lines = append(lines, "", fmt.Sprintf("%-14s %-8s %7s %7s %7s  %-18s %s", "JOB ID", "STATUS", "THREADS", "CPU EFF", "MEM EFF", "RAM USAGE", "NAME"))
+		for _, job := range jobs {
+			lines = append(lines, fmt.Sprintf("%-14s %-8s %7s %7s %7s  %-18s %s", job.JOBID, job.STAT, job.NTHREADS,
+				format_efficiency(job.cpu_efficiency()), format_efficiency(job.mem_efficiency()), job.mem_usage(), job.JOB_NAME))
+		}
+	}
+	return lines
+}
+
+// the project summary screen of how efficiently finished jobs used what they requested
+func open_efficiency_view(db map[string]recStruct) {
+	title := "Efficiency"
+	if projectBool {
+		title += " of " + proj_name
+	}
+	m := open_modal(title, efficiency_report_lines(db), "Close [E] ", func(key string) bool {
+		return key == "E" || key == "q" || key == "<Escape>"
+	})
+	m.full = true
+	m.render()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCpuEfficiency(t *testing.T) {
+	job := recStruct{RUN_TIME: "100 second(s)", NTHREADS: "4", CPU_USED: "200 second(s)"}
+	if efficiency, ok := job.cpu_efficiency(); !ok || efficiency != 50 {
+		t.Errorf("Expected 50%% CPU efficiency, got %v %v", efficiency, ok)
+	}
+
+	for _, job := range []recStruct{
+		{RUN_TIME: "100 second(s)", CPU_USED: "200 second(s)"},
+		{RUN_TIME: "0 second(s)", NTHREADS: "4", CPU_USED: "200 second(s)"},
+		{RUN_TIME: "100 second(s)", NTHREADS: "4"},
+	} {
+		if _, ok := job.cpu_efficiency(); ok {
+			t.Errorf("Expected unknown CPU efficiency for %+v", job)
+		}
+	}
+}
+
+func TestMemEfficiency(t *testing.T) {
+	job := recStruct{MAX_MEM: "2 Gbytes", MEMLIMIT: "8 G"}
+	if efficiency, ok := job.mem_efficiency(); !ok || efficiency != 25 {
+		t.Errorf("Expected 25%% memory efficiency, got %v %v", efficiency, ok)
+	}
+	if format_efficiency(job.mem_efficiency()) != "25%" {
+		t.Errorf("Unexpected formatted efficiency %q", format_efficiency(job.mem_efficiency()))
+	}
+	if format_efficiency(recStruct{}.mem_efficiency()) != "" {
+		t.Error("Expected a blank cell for unknown efficiency")
+	}
+}
+
+func efficiency_db() map[string]recStruct {
+	return map[string]recStruct{
+		// efficient
+		"1": {JOBID: "1", STAT: "DONE", RUN_TIME: "100 second(s)", NTHREADS: "2", CPU_USED: "180 second(s)", MAX_MEM: "7 Gbytes", MEMLIMIT: "8 G"},
+		// asked for far too much memory
+		"2": {JOBID: "2", STAT: "DONE", RUN_TIME: "100 second(s)", NTHREADS: "1", CPU_USED: "90 second(s)", MAX_MEM: "1 Gbytes", MEMLIMIT: "8 G"},
+		// asked for far too many threads
+		"3": {JOBID: "3", STAT: "EXIT", RUN_TIME: "100 second(s)", NTHREADS: "8", CPU_USED: "100 second(s)", MAX_MEM: "6 Gbytes", MEMLIMIT: "8 G"},
+		// still running, so not judged yet
+		"4": {JOBID: "4", STAT: "RUN", RUN_TIME: "100 second(s)", NTHREADS: "8", CPU_USED: "10 second(s)", MAX_MEM: "1 Gbytes", MEMLIMIT: "8 G"},
+	}
+}
+
+func TestSummariseEfficiency(t *testing.T) {
+	summary := summarise_efficiency(efficiency_db())
+	if summary.jobs != 3 || summary.cpu_jobs != 3 || summary.mem_jobs != 3 {
+		t.Errorf("Expected 3 finished jobs counted, got %+v", summary)
+	}
+	if summary.over_cpu != 1 || summary.over_mem != 1 {
+		t.Errorf("Expected one job over-requesting each resource, got %+v", summary)
+	}
+	if summary.mem_requested != 24e9 || summary.mem_used != 14e9 {
+		t.Errorf("Unexpected memory totals %+v", summary)
+	}
+}
+
+func TestOverRequestedJobs(t *testing.T) {
+	jobs := over_requested_jobs(efficiency_db())
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 over-requested jobs, got %d", len(jobs))
+	}
+	// both are at 12.5% of what they asked for, so the tie falls back to job ID
+	if jobs[0].JOBID != "2" || jobs[1].JOBID != "3" {
+		t.Errorf("Expected jobs 2 then 3, got %s then %s", jobs[0].JOBID, jobs[1].JOBID)
+	}
+}
+
+func TestEfficiencyReportLines(t *testing.T) {
+	lines := efficiency_report_lines(efficiency_db())
+	report := strings.Join(lines, "\n")
+	if !strings.Contains(report, "Finished jobs:       3") {
+		t.Errorf("Expected the finished job count in the report:\n%s", report)
+	}
+	if strings.Contains(report, "\n4 ") {
+		t.Errorf("Expected running jobs to be left out of the report:\n%s", report)
+	}
+
+	if lines := efficiency_report_lines(map[string]recStruct{}); len(lines) != 1 || lines[0] != "No finished jobs to report on" {
+		t.Errorf("Unexpected report for no jobs %v", lines)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// filterTerm is one condition of a filter, either free text or a
+// field comparison like "stat:EXIT" or "mem>80%"
+type filterTerm struct {
+	field  string // empty for free text
+	op     string // ":", ">", "<", ">=" or "<="
+	value  string
+	negate bool
+}
+
+// jobFilter narrows the jobs shown in the table to those matching every term
+type jobFilter struct {
+	text  string
+	terms []filterTerm
+}
+
+// the filter applied to the job table, empty when showing every job
+var active_filter jobFilter
+
+// fields that can be used in filter terms, and whether they compare numbers
+var filter_fields = map[string]bool{
+	"id":        false,
+	"stat":      false,
+	"queue":     false,
+	"exit":      false,
+	"exit_code": true,
+	"mem":       true,
+	"complete":  true,
+	"runtime":   true,
+	"group":     false,
+}
+
+// parse a filter like "stat:EXIT queue:long mem>80% exit_code:137",
+// where words without a field are matched against JOBID, queue and exit reason
+func parse_filter(text string) (jobFilter, error) {
+	filter := jobFilter{text: strings.TrimSpace(text)}
+	for _, word := range strings.Fields(text) {
+		term := filterTerm{}
+		if strings.HasPrefix(word, "-") || strings.HasPrefix(word, "!") {
+			term.negate = true
+			word = word[1:]
+		}
+
+		// find the first operator, checking two-character ones first
+		op_index := -1
+		for _, op := range []string{">=", "<=", ":", ">", "<"} {
+			if i := strings.Index(word, op); i > 0 && (op_index == -1 || i < op_index) {
+				op_index = i
+				term.op = op
+			}
+		}
+		if op_index == -1 {
+			term.value = word
+			filter.terms = append(filter.terms, term)
+			continue
+		}
+
+		term.field = strings.ToLower(word[:op_index])
+		term.value = word[op_index+len(term.op):]
+		numeric, known := filter_fields[term.field]
+		if !known {
+			return filter, errors.New("unknown field " + term.field)
+		}
+		if term.value == "" {
+			return filter, errors.New(term.field + term.op + " needs a value")
+		}
+		if term.op != ":" && !numeric {
+			return filter, errors.New(term.field + " can only be matched with :")
+		}
+		if numeric {
+			number := strings.TrimSuffix(term.value, "%")
+			if term.field == "mem" {
+				number = strings.TrimRight(strings.ToUpper(number), "TGMK")
+			}
+			if _, err := strconv.ParseFloat(number, 64); err != nil {
+				return filter, errors.New(term.field + " needs a number")
+			}
+		}
+		filter.terms = append(filter.terms, term)
+	}
+	return filter, nil
+}
+
+func (filter jobFilter) active() bool {
+	return len(filter.terms) > 0
+}
+
+// whether a job matches every term of the filter
+func (filter jobFilter) matches(job recStruct) bool {
+	for _, term := range filter.terms {
+		if term.matches(job) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (term filterTerm) matches(job recStruct) bool {
+	value := strings.ToLower(term.value)
+	switch term.field {
+	case "":
+		for _, field := range []string{job.JOBID, job.QUEUE, job.EXIT_REASON} {
+			if strings.Contains(strings.ToLower(field), value) {
+				return true
+			}
+		}
+		return false
+	case "id":
+		return strings.HasPrefix(job.JOBID, term.value)
+	case "stat":
+		// allow several statuses, e.g. stat:RUN,PEND, with SUSP matching
+		// every suspended state
+		for _, stat := range strings.Split(value, ",") {
+			if strings.EqualFold(job.STAT, stat) || strings.EqualFold(stat_group(job), stat) {
+				return true
+			}
+		}
+		return false
+	case "queue":
+		return strings.EqualFold(job.QUEUE, term.value)
+	case "exit":
+		return strings.Contains(strings.ToLower(job.EXIT_REASON), value)
+	case "exit_code":
+		if job.EXIT_CODE == "" {
+			return false
+		}
+		exit_code, _ := strconv.ParseFloat(job.EXIT_CODE, 64)
+		return compare_numbers(exit_code, term.op, term.value)
+	case "mem":
+		// sizes like mem>10G compare the memory used, percentages compare
+		// the memory used against the memory limit
+		if strings.HasSuffix(term.value, "%") {
+			mem_percent, ok := job.mem_percent()
+			return ok && compare_numbers(mem_percent, term.op, strings.TrimSuffix(term.value, "%"))
+		}
+		if job.MAX_MEM == "" {
+			return false
+		}
+		max_mem := parse_human_sizes(parse_bytes_output(job.MAX_MEM))
+		wanted := parse_human_sizes(strings.ToUpper(term.value))
+		return compare_numbers(max_mem, term.op, strconv.FormatFloat(wanted, 'f', -1, 64))
+	case "complete":
+		return job.COMPLETE != "" && compare_numbers(job.complete_percent(), term.op, strings.TrimSuffix(term.value, "%"))
+	case "runtime":
+		return job.RUN_TIME != "" && compare_numbers(job.run_time_seconds(), term.op, term.value)
+	case "group":
+		// a group matches the groups below it too, but not groups that only start with its name
+		group := "/" + strings.Join(group_names(job.JOB_GROUP), "/")
+		wanted := "/" + strings.Join(group_names(term.value), "/")
+		return group == wanted || wanted == "/" || strings.HasPrefix(group, wanted+"/")
+	}
+	return false
+}
+
+func compare_numbers(actual float64, op string, wanted_str string) bool {
+	wanted, err := strconv.ParseFloat(wanted_str, 64)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case ">":
+		return actual > wanted
+	case "<":
+		return actual < wanted
+	case ">=":
+		return actual >= wanted
+	case "<=":
+		return actual <= wanted
+	}
+	return actual == wanted
+}
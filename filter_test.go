@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+// jobs covering the fields the filter language can match on
+func createFilterTestJobs() []recStruct {
+	return []recStruct{
+		{JOBID: "81061", STAT: "RUN", QUEUE: "long", MAX_MEM: "270 Gbytes", MEMLIMIT: "293 G", COMPLETE: "50.5% L", RUN_TIME: "7200 second(s)", JOB_GROUP: "/pipeline/sample1/align"},
+		{JOBID: "79913", STAT: "EXIT", QUEUE: "normal", EXIT_REASON: "TERM_MEMLIMIT: job killed after reaching LSF memory usage limit", EXIT_CODE: "137", MAX_MEM: "8 Gbytes", MEMLIMIT: "8 G", JOB_GROUP: "/pipeline/sample1/call"},
+		{JOBID: "79914", STAT: "EXIT", QUEUE: "long", EXIT_REASON: "TERM_RUNLIMIT: job killed after reaching LSF run time limit", EXIT_CODE: "140", JOB_GROUP: "/pipeline/sample10"},
+		{JOBID: "79915", STAT: "PEND", QUEUE: "long"},
+		{JOBID: "79916", STAT: "DONE", QUEUE: "normal", MAX_MEM: "1 Gbytes", MEMLIMIT: "8 G", EXIT_CODE: "0"},
+	}
+}
+
+// count the test jobs matching a filter
+func countFilterMatches(t *testing.T, text string) int {
+	filter, err := parse_filter(text)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing filter %q: %v", text, err)
+	}
+	count := 0
+	for _, job := range createFilterTestJobs() {
+		if filter.matches(job) {
+			count++
+		}
+	}
+	return count
+}
+
+// Test matching jobs with the filter language
+func TestFilterMatches(t *testing.T) {
+	cases := map[string]int{
+		"":                         5,
+		"stat:EXIT":                2,
+		"stat:exit queue:long":     1,
+		"stat:RUN,PEND":            2,
+		"-stat:DONE":               4,
+		"memlimit":                 1,
+		"7991":                     4,
+		"exit:TERM_RUNLIMIT":       1,
+		"exit_code:137":            1,
+		"exit_code>0":              2,
+		"mem>80%":                  2,
+		"mem>=100%":                1,
+		"mem>10G":                  1,
+		"complete>50":              1,
+		"runtime>3600":             1,
+		"id:8106":                  1,
+		"group:/pipeline":          3,
+		"group:/pipeline/sample1":  2,
+		"group:/pipeline/sample1/": 2,
+		"-group:/pipeline":         2,
+	}
+	for text, expected := range cases {
+		if count := countFilterMatches(t, text); count != expected {
+			t.Errorf("Expected filter %q to match %d jobs, got %d", text, expected, count)
+		}
+	}
+}
+
+// Test that invalid filters are reported rather than applied
+func TestParseFilterErrors(t *testing.T) {
+	for _, text := range []string{"colour:red", "mem>", "queue>long", "exit_code>abc", "mem>lots"} {
+		if _, err := parse_filter(text); err == nil {
+			t.Errorf("Expected an error parsing filter %q", text)
+		}
+	}
+
+	filter, _ := parse_filter("   ")
+	if filter.active() {
+		t.Error("Expected a blank filter not to be active")
+	}
+}
+
+// Test the memory percentage used by filters
+func TestMemPercent(t *testing.T) {
+	job := recStruct{MAX_MEM: "80.5 Gbytes", MEMLIMIT: "161 G"}
+	mem_percent, ok := job.mem_percent()
+	if !ok || mem_percent != 50 {
+		t.Errorf("Expected decimal sizes to give 50%%, got %v", mem_percent)
+	}
+
+	if _, ok := (recStruct{MAX_MEM: "1 Gbytes"}).mem_percent(); ok {
+		t.Error("Expected no percentage without a memory limit")
+	}
+}
+
+// Test that pending and suspended jobs matched by a filter are listed in
+// the table, not only counted
+func TestFilterListsPendingAndSuspendedJobs(t *testing.T) {
+	defer func() { active_filter = jobFilter{} }()
+
+	db := map[string]recStruct{
+		"1": {JOBID: "1", STAT: "PEND"},
+		"2": {JOBID: "2", STAT: "USUSP"},
+		"3": {JOBID: "3", STAT: "SSUSP"},
+		"4": {JOBID: "4", STAT: "RUN"},
+	}
+	cases := map[string]int{"stat:PEND": 1, "stat:SUSP": 2, "stat:USUSP": 1, "stat:PEND,SUSP": 3}
+	for text, expected := range cases {
+		active_filter, _ = parse_filter(text)
+		if listed, _ := list_jobs(db); len(listed) != expected {
+			t.Errorf("Expected filter %q to list %d jobs, got %v", text, expected, listed)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// groupNode is a job group (bsub -g) in the tree of groups, counting the
+// jobs in it and in every group below it
+type groupNode struct {
+	name     string
+	path     string
+	counts   map[string]int
+	children []*groupNode
+}
+
+// groups collapsed in the tree, kept while bj runs so the tree reopens as it was left
+var collapsed_groups = make(map[string]bool)
+
+// the group a job belongs to as "/" separated names, empty for the top level
+func group_names(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// the node for a group, adding it and the groups above it to the tree
+func (node *groupNode) group(path string) *groupNode {
+	for _, name := range group_names(path) {
+		var child *groupNode
+		for _, existing := range node.children {
+			if existing.name == name {
+				child = existing
+			}
+		}
+		if child == nil {
+			child = &groupNode{name: name, path: strings.TrimSuffix(node.path, "/") + "/" + name, counts: make(map[string]int)}
+			node.children = append(node.children, child)
+		}
+		node = child
+	}
+	return node
+}
+
+// build the tree of job groups, counting each job in its group and every
+// group above it. Groups with no cached jobs, such as those bjgroup lists,
+// are included with no jobs
+func build_group_tree(db map[string]recStruct, groups []string) *groupNode {
+	root := &groupNode{name: "/", path: "/", counts: make(map[string]int)}
+	for _, path := range groups {
+		root.group(path)
+	}
+	for _, job := range db {
+		root.counts[job.STAT]++
+		node := root
+		for _, name := range group_names(job.JOB_GROUP) {
+			node = node.group(name)
+			node.counts[job.STAT]++
+		}
+	}
+	root.sort()
+	return root
+}
+
+func (node *groupNode) sort() {
+	sort.Slice(node.children, func(i int, j int) bool { return node.children[i].name < node.children[j].name })
+	for _, child := range node.children {
+		child.sort()
+	}
+}
+
+// the groups of the tree not hidden by a collapsed group, in the order they're listed
+func (node *groupNode) visible(depth int, visit func(node *groupNode, depth int)) {
+	visit(node, depth)
+	if collapsed_groups[node.path] {
+		return
+	}
+	for _, child := range node.children {
+		child.visible(depth+1, visit)
+	}
+}
+
+func (node *groupNode) line(depth int) string {
+	marker := " "
+	if len(node.children) > 0 && collapsed_groups[node.path] {
+		marker = "▸"
+	} else if len(node.children) > 0 {
+		marker = "▾"
+	}
+	name := strings.Repeat("  ", depth) + marker + " " + node.name
+	if name_rune := []rune(name); len(name_rune) > 40 {
+		name = string(name_rune[:37]) + "..."
+	}
+	return fmt.Sprintf("%-40s %6d %6d %6d %6d", name, node.counts["RUN"], node.counts["PEND"], node.counts["DONE"], node.counts["EXIT"])
+}
+
+// the job groups of the user that bjgroup lists
+func run_bjgroup() ([]string, error) {
+	out, err := exec.Command("bjgroup").Output()
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	owner := ""
+	if current, err := user.Current(); err == nil {
+		owner = current.Username
+	}
+	return parse_bjgroup(string(out), owner), nil
+}
+
+// the groups in bjgroup output owned by owner, or by anyone when owner is empty
+func parse_bjgroup(output string, owner string) []string {
+	var groups []string
+	for _, row := range parse_columns(output) {
+		if owner == "" || row["OWNER"] == owner {
+			groups = append(groups, row["GROUP_NAME"])
+		}
+	}
+	return groups
+}
+
+// filter the table to a group and the groups below it, in place of any
+// group the filter already had
+func filter_to_group(path string) error {
+	var words []string
+	for _, word := range strings.Fields(active_filter.text) {
+		if !strings.HasPrefix(strings.ToLower(word), "group:") {
+			words = append(words, word)
+		}
+	}
+	if path != "/" {
+		words = append(words, "group:"+path)
+	}
+	filter, err := parse_filter(strings.Join(words, " "))
+	if err != nil {
+		return err
+	}
+	active_filter = filter
+	return nil
+}
+
+// the tree of job groups, with the jobs in each group and those below it
+func open_group_view(db map[string]recStruct) {
+	// bjgroup lists every group, so only the groups of the watched project's jobs are shown for a project
+	var groups []string
+	var err error
+	if !projectBool {
+		groups, err = run_bjgroup()
+	}
+	root := build_group_tree(db, groups)
+
+	hint := "Filter to group [Enter]  Collapse/expand [Space ← →]  Close [G] "
+	if err != nil {
+		hint = "Error running bjgroup: " + err.Error() + "  " + hint
+	}
+	m := open_modal("Job groups", nil, hint, nil)
+	var nodes []*groupNode
+	list := func() {
+		selected := ""
+		if len(nodes) > 0 {
+			selected = nodes[m.selected-m.first_choice].path
+		}
+		nodes = nil
+		m.lines = []string{fmt.Sprintf("[%-40s %6s %6s %6s %6s](fg:yellow,mod:bold)", "GROUP", "RUN", "PEND", "DONE", "EXIT")}
+		root.visible(0, func(node *groupNode, depth int) {
+			if node.path == selected {
+				m.selected = len(m.lines)
+			}
+			nodes = append(nodes, node)
+			m.lines = append(m.lines, node.line(depth))
+		})
+	}
+
+	m.on_key = func(key string) bool {
+		node := nodes[m.selected-m.first_choice]
+		switch key {
+		case "<Enter>":
+			if err := filter_to_group(node.path); err != nil {
+				async_statusline_message("Error filtering to group: "+err.Error(), 3)
+			}
+			return true
+		case "<Space>":
+			collapsed_groups[node.path] = !collapsed_groups[node.path]
+		case "<Left>":
+			collapsed_groups[node.path] = true
+		case "<Right>":
+			delete(collapsed_groups, node.path)
+		case "G", "q", "<Escape>":
+			return true
+		}
+		list()
+		return false
+	}
+	m.full = true
+	m.selectable = true
+	m.first_choice = 1
+	list()
+	m.move_selection(0)
+	m.render()
+}
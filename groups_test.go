@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBjgroup(t *testing.T) {
+	output := read_fixture(t, "test/data/bjgroup.txt")
+	if groups := parse_bjgroup(output, "slaidlaw"); strings.Join(groups, ",") != "/pipeline,/pipeline/sample1,/pipeline/sample2" {
+		t.Errorf("Expected the groups owned by the user, got %v", groups)
+	}
+	if groups := parse_bjgroup(output, ""); len(groups) != 4 {
+		t.Errorf("Expected every group without an owner, got %v", groups)
+	}
+}
+
+func TestBuildGroupTree(t *testing.T) {
+	defer func() { collapsed_groups = make(map[string]bool) }()
+	db := map[string]recStruct{
+		"1": {JOBID: "1", STAT: "RUN", JOB_GROUP: "/pipeline/sample1/align"},
+		"2": {JOBID: "2", STAT: "EXIT", JOB_GROUP: "/pipeline/sample1/call"},
+		"3": {JOBID: "3", STAT: "DONE", JOB_GROUP: "/pipeline/sample10"},
+		"4": {JOBID: "4", STAT: "PEND"},
+	}
+	root := build_group_tree(db, []string{"/pipeline/sample2"})
+	if root.counts["RUN"] != 1 || root.counts["PEND"] != 1 || root.counts["DONE"] != 1 || root.counts["EXIT"] != 1 {
+		t.Errorf("Expected every job counted at the top, got %v", root.counts)
+	}
+
+	var paths []string
+	root.visible(0, func(node *groupNode, depth int) { paths = append(paths, node.path) })
+	expected := "/,/pipeline,/pipeline/sample1,/pipeline/sample1/align,/pipeline/sample1/call,/pipeline/sample10,/pipeline/sample2"
+	if strings.Join(paths, ",") != expected {
+		t.Errorf("Unexpected groups %v", paths)
+	}
+
+	pipeline := root.children[0]
+	if pipeline.counts["RUN"] != 1 || pipeline.counts["EXIT"] != 1 || pipeline.counts["DONE"] != 1 || pipeline.counts["PEND"] != 0 {
+		t.Errorf("Expected the pipeline's groups rolled up into it, got %v", pipeline.counts)
+	}
+	if sample2 := pipeline.children[2]; sample2.path != "/pipeline/sample2" || len(sample2.counts) != 0 {
+		t.Errorf("Expected an empty group from bjgroup, got %+v", sample2)
+	}
+
+	collapsed_groups["/pipeline/sample1"] = true
+	paths = nil
+	root.visible(0, func(node *groupNode, depth int) { paths = append(paths, node.path) })
+	if strings.Join(paths, ",") != "/,/pipeline,/pipeline/sample1,/pipeline/sample10,/pipeline/sample2" {
+		t.Errorf("Expected a collapsed group to hide those below it, got %v", paths)
+	}
+	if line := pipeline.children[0].line(2); !strings.HasPrefix(line, "    ▸ sample1") {
+		t.Errorf("Unexpected line for a collapsed group %q", line)
+	}
+}
+
+func TestFilterToGroup(t *testing.T) {
+	defer func() { active_filter = jobFilter{} }()
+	active_filter, _ = parse_filter("stat:EXIT group:/other")
+	if err := filter_to_group("/pipeline/sample1"); err != nil {
+		t.Fatal(err)
+	}
+	if active_filter.text != "stat:EXIT group:/pipeline/sample1" {
+		t.Errorf("Expected the group replaced in the filter, got %q", active_filter.text)
+	}
+	filter_to_group("/")
+	if active_filter.text != "stat:EXIT" {
+		t.Errorf("Expected the top group to remove the group from the filter, got %q", active_filter.text)
+	}
+}
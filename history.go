@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+// minimum seconds between the resource samples kept for a job, and the
+// most samples kept per job before the oldest are dropped
+const sample_interval = 30
+const max_history_samples = 2000
+
+// resourceSample is a running job's resource usage at one poll of bjobs
+type resourceSample struct {
+	Time     int64   `json:"t"`    // unix seconds
+	Mem      float64 `json:"mem"`  // bytes currently used
+	Swap     float64 `json:"swap"` // bytes of swap used
+	CPU      float64 `json:"cpu"`  // seconds of CPU time used so far
+	Complete float64 `json:"complete"`
+}
+
+// the resource samples of each job, oldest first, keyed by JOBID
+var resource_history = make(map[string][]resourceSample)
+
+// memory currently used by the job, falling back to its peak usage when
+// bjobs doesn't report current usage
+func (rec recStruct) mem_bytes() float64 {
+	if rec.MEM != "" {
+		return parse_human_sizes(parse_bytes_output(rec.MEM))
+	}
+	return parse_human_sizes(parse_bytes_output(rec.MAX_MEM))
+}
+
+// CPU time in seconds, from CPU_USED values like "1234.5 second(s)"
+func (rec recStruct) cpu_seconds() float64 {
+	cpu_used, _ := strconv.ParseFloat(strings.TrimSpace(strings.Replace(rec.CPU_USED, "second(s)", "", 1)), 64)
+	return cpu_used
+}
+
+// add a sample for each running job, at most one every sample_interval
+// seconds, returning whether any sample was added
+func record_resource_samples(history map[string][]resourceSample, bjobs_map map[string]recStruct, now int64) bool {
+	sampled := false
+	for id, job := range bjobs_map {
+		if job.STAT != "RUN" {
+			continue
+		}
+		samples := history[id]
+		if len(samples) > 0 && now-samples[len(samples)-1].Time < sample_interval {
+			continue
+		}
+
+		samples = append(samples, resourceSample{
+			Time:     now,
+			Mem:      job.mem_bytes(),
+			Swap:     parse_human_sizes(parse_bytes_output(job.SWAP)),
+			CPU:      job.cpu_seconds(),
+			Complete: job.complete_percent(),
+		})
+		if len(samples) > max_history_samples {
+			samples = samples[len(samples)-max_history_samples:]
+		}
+		history[id] = samples
+		sampled = true
+	}
+	return sampled
+}
+
+// a glyph for whether a job's memory is climbing, falling or has
+// plateaued, comparing its latest usage with that a few samples earlier
+func mem_trend(samples []resourceSample) string {
+	if len(samples) < 3 {
+		return ""
+	}
+	earlier := samples[len(samples)-3]
+	if len(samples) > 6 {
+		earlier = samples[len(samples)-6]
+	}
+	latest := samples[len(samples)-1]
+
+	if earlier.Mem == 0 {
+		if latest.Mem > 0 {
+			return "↗"
+		}
+		return "→"
+	}
+	change := (latest.Mem - earlier.Mem) / earlier.Mem
+	switch {
+	case change > 0.05:
+		return "↗"
+	case change < -0.05:
+		return "↘"
+	}
+	return "→"
+}
+
+// cores used between each pair of samples, from the change in CPU time
+func cpu_rates(samples []resourceSample) []float64 {
+	var rates []float64
+	for i := 1; i < len(samples); i++ {
+		elapsed := float64(samples[i].Time - samples[i-1].Time)
+		rate := 0.0
+		if elapsed > 0 && samples[i].CPU >= samples[i-1].CPU {
+			rate = (samples[i].CPU - samples[i-1].CPU) / elapsed
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+func readSavedHistory(usr_config string) map[string][]resourceSample {
+	history := make(map[string][]resourceSample)
+	if _, err := os.Stat(usr_config); os.IsNotExist(err) {
+		return history
+	}
+	err := with_store(usr_config, false, func(tx *bolt.Tx) error {
+		var err error
+		history, err = load_samples(tx)
+		return err
+	})
+	if err != nil {
+		statusline.Text = "Error in reading resource history: " + err.Error()
+		ui.Render(statusline_grid)
+	}
+	return history
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordResourceSamples(t *testing.T) {
+	history := make(map[string][]resourceSample)
+	bjobs_map := map[string]recStruct{
+		"100": {JOBID: "100", STAT: "RUN", MEM: "2 Gbytes", SWAP: "512 Mbytes", CPU_USED: "60 second(s)", COMPLETE: "10.00% L"},
+		"101": {JOBID: "101", STAT: "PEND"},
+	}
+
+	if !record_resource_samples(history, bjobs_map, 1000) {
+		t.Error("Expected a sample to be recorded for the running job")
+	}
+	if len(history["101"]) != 0 {
+		t.Error("Expected no samples for a pending job")
+	}
+	sample := history["100"][0]
+	if sample.Mem != 2e9 || sample.Swap != 512e6 || sample.CPU != 60 || sample.Complete != 10 {
+		t.Errorf("Unexpected sample %+v", sample)
+	}
+
+	// polls within the interval don't add samples
+	if record_resource_samples(history, bjobs_map, 1000+sample_interval-1) {
+		t.Error("Expected no sample within the sampling interval")
+	}
+	record_resource_samples(history, bjobs_map, 1000+sample_interval)
+	if len(history["100"]) != 2 {
+		t.Errorf("Expected 2 samples, got %d", len(history["100"]))
+	}
+}
+
+func TestRecordResourceSamplesFallsBackToMaxMem(t *testing.T) {
+	history := make(map[string][]resourceSample)
+	record_resource_samples(history, map[string]recStruct{"100": {JOBID: "100", STAT: "RUN", MAX_MEM: "1.5 Gbytes"}}, 0)
+	if history["100"][0].Mem != 1.5e9 {
+		t.Errorf("Expected MAX_MEM to be used without MEM, got %v", history["100"][0].Mem)
+	}
+}
+
+func TestRecordResourceSamplesCap(t *testing.T) {
+	history := make(map[string][]resourceSample)
+	bjobs_map := map[string]recStruct{"100": {JOBID: "100", STAT: "RUN"}}
+	for i := 0; i < max_history_samples+10; i++ {
+		record_resource_samples(history, bjobs_map, int64(i*sample_interval))
+	}
+	samples := history["100"]
+	if len(samples) != max_history_samples {
+		t.Fatalf("Expected history capped at %d samples, got %d", max_history_samples, len(samples))
+	}
+	if samples[0].Time != int64(10*sample_interval) {
+		t.Errorf("Expected the oldest samples to be dropped, first is at %d", samples[0].Time)
+	}
+}
+
+func TestMemTrend(t *testing.T) {
+	mem_samples := func(mems ...float64) []resourceSample {
+		var samples []resourceSample
+		for i, mem := range mems {
+			samples = append(samples, resourceSample{Time: int64(i * sample_interval), Mem: mem})
+		}
+		return samples
+	}
+
+	tests := []struct {
+		samples  []resourceSample
+		expected string
+	}{
+		{mem_samples(1, 2), ""},
+		{mem_samples(100, 110, 120), "↗"},
+		{mem_samples(120, 110, 100), "↘"},
+		{mem_samples(100, 101, 102), "→"},
+		{mem_samples(0, 0, 0), "→"},
+		{mem_samples(0, 0, 10), "↗"},
+		// the comparison reaches back five samples once there are enough
+		{mem_samples(100, 200, 200, 200, 200, 200, 200), "→"},
+	}
+	for _, tt := range tests {
+		if got := mem_trend(tt.samples); got != tt.expected {
+			t.Errorf("mem_trend(%v) = %q, expected %q", tt.samples, got, tt.expected)
+		}
+	}
+}
+
+func TestCpuRates(t *testing.T) {
+	samples := []resourceSample{
+		{Time: 0, CPU: 0},
+		{Time: 30, CPU: 120},
+		{Time: 60, CPU: 150},
+		// a requeued job restarts its CPU time, which shouldn't give a negative rate
+		{Time: 90, CPU: 10},
+	}
+	rates := cpu_rates(samples)
+	expected := []float64{4, 1, 0}
+	if len(rates) != len(expected) {
+		t.Fatalf("Expected %d rates, got %d", len(expected), len(rates))
+	}
+	for i := range expected {
+		if rates[i] != expected[i] {
+			t.Errorf("Rate %d = %v, expected %v", i, rates[i], expected[i])
+		}
+	}
+	if len(cpu_rates(samples[:1])) != 0 {
+		t.Error("Expected no rates from a single sample")
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	usr_history := filepath.Join(dir, "history.db")
+	history := map[string][]resourceSample{
+		"100": {{Time: 30, Mem: 2e9, Swap: 0, CPU: 12.5, Complete: 3}},
+	}
+	writeDatabase(dir, usr_history, nil, history)
+
+	loaded := readSavedHistory(usr_history)
+	if len(loaded["100"]) != 1 || loaded["100"][0] != history["100"][0] {
+		t.Errorf("Expected %v after reading back, got %v", history, loaded)
+	}
+	if len(readSavedHistory(filepath.Join(dir, "missing.json"))) != 0 {
+		t.Error("Expected empty history when there is no saved file")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0B",
+		512:     "512B",
+		1.5e3:   "1.5K",
+		2e9:     "2G",
+		12.34e9: "12.3G",
+		3e12:    "3T",
+	}
+	for size, expected := range tests {
+		if got := format_bytes(size); got != expected {
+			t.Errorf("format_bytes(%v) = %q, expected %q", size, got, expected)
+		}
+	}
+}
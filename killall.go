@@ -0,0 +1,188 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+// number of job IDs given to each bkill invocation when killing all jobs
+const kill_batch_size = 100
+
+// whether a kill-all is in progress, so a second one isn't started on top
+var kill_running bool
+
+// matches the per-job lines bkill prints, e.g. "Job <123> is being terminated"
+// or "Job <123[4]>: Job has already finished"
+var bkill_line_regex = regexp.MustCompile(`^Job <([^>]+)>:? ?(.*)$`)
+
+// outcomes of killing a job, in the order they're reported
+const (
+	kill_killed            = "Killed"
+	kill_already_finished  = "Already finished"
+	kill_permission_denied = "Permission denied"
+	kill_failed            = "Failed"
+)
+
+// IDs of jobs that can still be killed, skipping cached DONE and EXIT jobs
+func active_jobids(db map[string]recStruct) []string {
+	var ids []string
+	for id, job := range db {
+		switch job.STAT {
+		case "RUN", "PEND", "USUSP", "SSUSP", "PSUSP":
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return jobid_less(ids[i], ids[j]) })
+	return ids
+}
+
+// split job IDs into groups of at most size
+func batch_jobids(ids []string, size int) [][]string {
+	var batches [][]string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+	return batches
+}
+
+// sort a bkill message for one job into one of the kill outcomes
+func classify_bkill_message(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "is being terminated"), strings.Contains(message, "is being signaled"):
+		return kill_killed
+	case strings.Contains(message, "already finished"), strings.Contains(message, "no matching job"):
+		return kill_already_finished
+	case strings.Contains(message, "permission denied"), strings.Contains(message, "not the owner"), strings.Contains(message, "not owner"):
+		return kill_permission_denied
+	}
+	return kill_failed
+}
+
+// the outcome and message for each job of a batched bkill, falling back to
+// the command's error for jobs bkill didn't mention
+func parse_bkill_results(results []commandResult) map[string][2]string {
+	outcomes := make(map[string][2]string)
+	for _, result := range results {
+		for _, line := range strings.Split(result.output, "\n") {
+			match := bkill_line_regex.FindStringSubmatch(strings.TrimSpace(line))
+			if match == nil {
+				continue
+			}
+			outcomes[match[1]] = [2]string{classify_bkill_message(match[2]), match[2]}
+		}
+
+		// the command's arguments after "bkill" are the job IDs of the batch
+		for _, id := range result.args[1:] {
+			if _, ok := outcomes[id]; ok {
+				continue
+			}
+			message := "no output from bkill"
+			if result.err != nil {
+				message = result.err.Error()
+			}
+			outcomes[id] = [2]string{kill_failed, message}
+		}
+	}
+	return outcomes
+}
+
+// lines of the final kill-all report, counts first then each job by outcome
+func kill_report_lines(outcomes map[string][2]string) []string {
+	by_outcome := make(map[string][]string)
+	for id, outcome := range outcomes {
+		by_outcome[outcome[0]] = append(by_outcome[outcome[0]], id)
+	}
+
+	order := []string{kill_killed, kill_already_finished, kill_permission_denied, kill_failed}
+	var counts []string
+	for _, outcome := range order {
+		counts = append(counts, outcome+": "+strconv.Itoa(len(by_outcome[outcome])))
+	}
+	lines := []string{strings.Join(counts, "  ")}
+
+	for _, outcome := range order {
+		ids := by_outcome[outcome]
+		if len(ids) == 0 {
+			continue
+		}
+		sort.Slice(ids, func(i, j int) bool { return jobid_less(ids[i], ids[j]) })
+		lines = append(lines, "", outcome+":")
+		for _, id := range ids {
+			line := "  " + id
+			// the killed message is the same for every job so isn't repeated
+			if outcome != kill_killed && outcomes[id][1] != "" {
+				line += "  " + outcomes[id][1]
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ask for confirmation before killing every unfinished job
+func confirm_kill_all(db map[string]recStruct) {
+	ids := active_jobids(db)
+
+	// specify that only project ids will be killed if we have a project subview
+	projectText := ""
+	if projectBool {
+		projectText = " for project " + proj_name
+	}
+
+	lines := []string{"Kill all " + strconv.Itoa(len(ids)) + " unfinished jobs" + projectText + "?", ""}
+	lines = append(lines, ids...)
+	open_modal("Kill all jobs", lines, "Confirm [y]  Cancel [n] ", func(key string) bool {
+		switch key {
+		case "y":
+			start_kill_all(ids)
+			return true
+		case "n", "<Escape>", "q":
+			return true
+		}
+		return false
+	})
+}
+
+// kill the jobs in batches in the background, showing progress on the
+// statusline and the report once every batch has finished
+func start_kill_all(ids []string) {
+	kill_running = true
+	batches := batch_jobids(ids, kill_batch_size)
+	var cmds [][]string
+	for _, batch := range batches {
+		cmds = append(cmds, append([]string{"bkill"}, batch...))
+	}
+
+	go func() {
+		results := run_commands(cmds, func(done int, total int) {
+			ui_updates <- func() {
+				if active_prompt == nil && active_modal == nil {
+					statusline.TextStyle.Fg = ColorRed
+					statusline.Text = "Killing " + strconv.Itoa(len(ids)) + " jobs: " + strconv.Itoa(done) + "/" + strconv.Itoa(total) + " bkill batches finished"
+					ui.Render(statusline_grid)
+				}
+			}
+		})
+
+		ui_updates <- func() {
+			kill_running = false
+			statusline.TextStyle.Fg = ColorGrey
+			show_kill_report(parse_bkill_results(results))
+		}
+	}()
+}
+
+func show_kill_report(outcomes map[string][2]string) {
+	open_modal("Kill all results", kill_report_lines(outcomes), "Close [q] ", func(key string) bool {
+		return key == "q" || key == "<Escape>" || key == "<Enter>"
+	})
+}
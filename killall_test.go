@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test that only unfinished jobs are targeted by kill all
+func TestActiveJobids(t *testing.T) {
+	db := map[string]recStruct{
+		"10000": {JOBID: "10000", STAT: "RUN"},
+		"9999":  {JOBID: "9999", STAT: "PEND"},
+		"81061": {JOBID: "81061", STAT: "USUSP"},
+		"79913": {JOBID: "79913", STAT: "DONE"},
+		"99999": {JOBID: "99999", STAT: "EXIT"},
+	}
+
+	ids := active_jobids(db)
+	expected := []string{"9999", "10000", "81061"}
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected active jobs %v, got %v", expected, ids)
+	}
+}
+
+// Test that job IDs are split into bkill batches
+func TestBatchJobids(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5"}
+
+	batches := batch_jobids(ids, 2)
+	if len(batches) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(batches))
+	}
+	if len(batches[2]) != 1 || batches[2][0] != "5" {
+		t.Errorf("Expected last batch to hold the remaining job, got %v", batches[2])
+	}
+
+	if len(batch_jobids(nil, 2)) != 0 {
+		t.Error("Expected no batches for no jobs")
+	}
+}
+
+// Test that bkill output is sorted into killed, already finished and permission denied
+func TestParseBkillResults(t *testing.T) {
+	results := []commandResult{
+		{
+			args:   []string{"bkill", "81061", "79913", "99999"},
+			output: "Job <81061> is being terminated\nJob <79913>: Job has already finished\nJob <99999>: User permission denied\n",
+			err:    errors.New("exit status 255"),
+		},
+		{
+			args: []string{"bkill", "12345"},
+			err:  errors.New("executable file not found in $PATH"),
+		},
+	}
+
+	outcomes := parse_bkill_results(results)
+	expected := map[string]string{
+		"81061": kill_killed,
+		"79913": kill_already_finished,
+		"99999": kill_permission_denied,
+		"12345": kill_failed,
+	}
+	for id, outcome := range expected {
+		if outcomes[id][0] != outcome {
+			t.Errorf("Expected job %s to be %q, got %q", id, outcome, outcomes[id][0])
+		}
+	}
+	if outcomes["12345"][1] != "executable file not found in $PATH" {
+		t.Errorf("Expected failed batch to report the command error, got %q", outcomes["12345"][1])
+	}
+
+	lines := kill_report_lines(outcomes)
+	if lines[0] != "Killed: 1  Already finished: 1  Permission denied: 1  Failed: 1" {
+		t.Errorf("Unexpected report summary %q", lines[0])
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// modalPane is a scrollable box drawn over the job table, used for menus,
+// confirmations and reports of commands run on jobs
+type modalPane struct {
+	pane   *widgets.Paragraph
+	lines  []string
+	offset int
+	hint   string
+	// fill the area of the job table rather than a box in its centre
+	full bool
+	// move a selection through the lines with the arrow keys instead of
+	// scrolling, from first_choice on so headings above it can't be chosen
+	selectable   bool
+	selected     int
+	first_choice int
+	// handles any key that isn't scrolling, returning true to close the modal
+	on_key func(key string) bool
+}
+
+// the modal currently open, nil when none is
+var active_modal *modalPane
+
+func open_modal(title string, lines []string, hint string, on_key func(key string) bool) *modalPane {
+	m := &modalPane{
+		pane:   widgets.NewParagraph(),
+		lines:  lines,
+		hint:   hint,
+		on_key: on_key,
+	}
+	m.pane.Title = " " + title + " "
+	m.pane.TitleStyle.Fg = ColorYellow
+	m.pane.BorderStyle.Fg = ColorYellow
+	m.pane.WrapText = false
+	active_modal = m
+	m.render()
+	return m
+}
+
+func (m *modalPane) height() int {
+	if m.full {
+		return termHeight - 3 - 2
+	}
+	height := len(m.lines)
+	if height > termHeight-8 {
+		height = termHeight - 8
+	}
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
+func (m *modalPane) render() {
+	// centre the box over the job table
+	width := termWidth * 3 / 4
+	if width < 40 {
+		width = termWidth
+	}
+	x := (termWidth - width) / 2
+	y := (termHeight - 3 - m.height() - 2) / 2
+	if m.full {
+		x, y, width = 0, 0, termWidth
+	}
+	m.pane.SetRect(x, y, x+width, y+m.height()+2)
+
+	max_offset := len(m.lines) - m.height()
+	if m.offset > max_offset {
+		m.offset = max_offset
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+	end := m.offset + m.height()
+	if end > len(m.lines) {
+		end = len(m.lines)
+	}
+
+	m.pane.Text = ""
+	for i, line := range m.lines[m.offset:end] {
+		if i > 0 {
+			m.pane.Text += "\n"
+		}
+		if m.selectable && m.offset+i == m.selected {
+			line = "> " + line
+		} else if m.selectable && m.offset+i >= m.first_choice {
+			line = "  " + line
+		}
+		m.pane.Text += line
+	}
+	ui.Render(m.pane)
+
+	hint := m.hint
+	if len(m.lines) > m.height() {
+		hint = fmt.Sprintf("[%d-%d/%d] Scroll [↑↓ PgUp PgDn]  ", m.offset+1, end, len(m.lines)) + hint
+	}
+	statusline.TextStyle.Fg = ColorYellow
+	statusline.Text = hint
+	ui.Render(statusline_grid)
+}
+
+// handle a key press while the modal is open, returning true when it
+// has been closed and the job table underneath needs redrawing
+func (m *modalPane) handle_event(e ui.Event) bool {
+	switch e.ID {
+	case "<Up>":
+		if m.selectable {
+			m.move_selection(-1)
+		} else {
+			m.offset--
+		}
+	case "<Down>":
+		if m.selectable {
+			m.move_selection(1)
+		} else {
+			m.offset++
+		}
+	case "<PageUp>":
+		if m.selectable {
+			m.move_selection(-m.height())
+		} else {
+			m.offset -= m.height()
+		}
+	case "<PageDown>":
+		if m.selectable {
+			m.move_selection(m.height())
+		} else {
+			m.offset += m.height()
+		}
+	default:
+		if m.on_key(e.ID) {
+			if active_modal == m {
+				active_modal = nil
+			}
+			statusline.TextStyle.Fg = ColorGrey
+			return true
+		}
+		// the key may have opened a different modal or a prompt in place of this one
+		if active_modal != m {
+			return false
+		}
+	}
+	m.render()
+	return false
+}
+
+// move the selected line by delta, scrolling it into view
+func (m *modalPane) move_selection(delta int) {
+	m.selected += delta
+	if m.selected >= len(m.lines) {
+		m.selected = len(m.lines) - 1
+	}
+	if m.selected < m.first_choice {
+		m.selected = m.first_choice
+	}
+	if m.selected < m.offset {
+		m.offset = m.selected
+	} else if m.selected >= m.offset+m.height() {
+		m.offset = m.selected - m.height() + 1
+	}
+}
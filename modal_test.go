@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestModalMoveSelection(t *testing.T) {
+	termHeight = 10
+	m := &modalPane{lines: []string{"heading", "", "a", "b", "c", "d", "e", "f", "g"}, selectable: true, first_choice: 2}
+	m.move_selection(0)
+	if m.selected != 2 {
+		t.Errorf("Expected the selection to start at the first choice, got %d", m.selected)
+	}
+	m.move_selection(100)
+	if m.selected != 8 || m.offset != 8-m.height()+1 {
+		t.Errorf("Expected the last line selected and scrolled into view, got %d at offset %d", m.selected, m.offset)
+	}
+	m.move_selection(-100)
+	if m.selected != 2 || m.offset != 2 {
+		t.Errorf("Expected the first choice selected and scrolled into view, got %d at offset %d", m.selected, m.offset)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// maximum number of bytes read from the end of a job's output file,
+// so that multi-gigabyte logs don't stall the interface
+const output_tail_bytes = 4 * 1024 * 1024
+
+const output_hint = "Scroll [↑↓ PgUp PgDn]  Follow [f]  Search [/ n N]  Pager [p]  Close [q] "
+
+// outputViewer is the scrollable pane showing the bpeek output of a
+// running job, or the stdout/stderr files of a finished one
+type outputViewer struct {
+	pane    *widgets.Paragraph
+	job     recStruct
+	source  string // where the lines were read from, shown in the title
+	lines   []string
+	offset  int  // index of the first visible line
+	follow  bool // keep the newest output in view on each refresh
+	search  string
+	matches []int // indexes of the lines matching search
+	match   int   // position in matches of the current match
+	// the output is being read in the background, as bpeek and large
+	// files on network filesystems can be slow
+	loading bool
+}
+
+// the output viewer currently open, nil when the job table is showing
+var output_view *outputViewer
+
+func open_output_view(job recStruct) {
+	output_view = &outputViewer{
+		pane:   widgets.NewParagraph(),
+		job:    job,
+		follow: true,
+	}
+	output_view.pane.WrapText = false
+	output_view.pane.BorderStyle.Fg = ColorBlue
+	output_view.pane.TitleStyle.Fg = ColorYellow
+	output_view.source = "loading"
+	output_view.lines = []string{"Fetching output..."}
+	output_view.load()
+	output_view.render()
+	show_output_hint()
+}
+
+func show_output_hint() {
+	statusline.TextStyle.Fg = ColorGrey
+	statusline.Text = output_hint
+	ui.Render(statusline_grid)
+}
+
+// re-read the job's output in the background, keeping the scroll position
+// unless following, with the viewer drawn again once it's read. A load
+// still running is left to finish rather than starting another
+func (ov *outputViewer) load() {
+	if ov.loading {
+		return
+	}
+	ov.loading = true
+	job := ov.job
+	go func() {
+		source, text, err := fetch_job_output(job)
+		if err != nil {
+			text = "Error: " + err.Error() + "\n" + text
+		}
+		lines := split_output_lines(text)
+		ui_updates <- func() {
+			ov.loading = false
+			ov.source, ov.lines = source, lines
+			ov.matches = find_matches(ov.lines, ov.search)
+			if ov.match >= len(ov.matches) {
+				ov.match = 0
+			}
+		}
+	}()
+}
+
+func (ov *outputViewer) height() int {
+	return termHeight - 3 - 2
+}
+
+func (ov *outputViewer) clamp_offset() {
+	max_offset := len(ov.lines) - ov.height()
+	if max_offset < 0 {
+		max_offset = 0
+	}
+	if ov.follow || ov.offset > max_offset {
+		ov.offset = max_offset
+	}
+	if ov.offset < 0 {
+		ov.offset = 0
+	}
+}
+
+func (ov *outputViewer) render() {
+	ov.pane.SetRect(0, 0, termWidth, termHeight-3)
+	ov.clamp_offset()
+
+	end := ov.offset + ov.height()
+	if end > len(ov.lines) {
+		end = len(ov.lines)
+	}
+
+	// mark matching lines in a gutter rather than with style markup, and
+	// swap the brackets termui parses styles from out of the output itself
+	current_match := -1
+	if len(ov.matches) > 0 {
+		current_match = ov.matches[ov.match]
+	}
+	visible := make([]string, 0, end-ov.offset)
+	for i := ov.offset; i < end; i++ {
+		line := markup_text(ov.lines[i])
+		if ov.search != "" {
+			gutter := "  "
+			if i == current_match {
+				gutter = "▶ "
+			} else if is_match(ov.lines[i], ov.search) {
+				gutter = "• "
+			}
+			line = gutter + line
+		}
+		visible = append(visible, line)
+	}
+	ov.pane.Text = strings.Join(visible, "\n")
+
+	title := fmt.Sprintf(" Job %s: %s [%d-%d/%d]", ov.job.JOBID, ov.source, ov.offset+1, end, len(ov.lines))
+	if ov.follow {
+		title += " following"
+	}
+	if ov.search != "" {
+		title += fmt.Sprintf(" /%s (%d matches)", ov.search, len(ov.matches))
+	}
+	ov.pane.Title = title + " "
+	ui.Render(ov.pane)
+}
+
+// scroll so the current search match is in the middle of the pane
+func (ov *outputViewer) show_match() {
+	if len(ov.matches) == 0 {
+		return
+	}
+	ov.follow = false
+	ov.offset = ov.matches[ov.match] - ov.height()/2
+}
+
+// handle a key press while the viewer is open, returning true when the
+// viewer has been closed or the terminal needs redrawing
+func (ov *outputViewer) handle_event(e ui.Event) bool {
+	switch e.ID {
+	case "q", "o", "<Escape>":
+		output_view = nil
+		return true
+	case "<Up>":
+		ov.follow = false
+		ov.offset--
+	case "<Down>":
+		ov.offset++
+	case "<PageUp>":
+		ov.follow = false
+		ov.offset -= ov.height()
+	case "<PageDown>":
+		ov.offset += ov.height()
+	case "g", "<Home>":
+		ov.follow = false
+		ov.offset = 0
+	case "G", "<End>":
+		ov.follow = true
+	case "f":
+		ov.follow = !ov.follow
+	case "/":
+		open_prompt("Search output: ", ov.search, func(text string) {
+			ov.search = text
+			ov.matches = find_matches(ov.lines, ov.search)
+			ov.match = 0
+			ov.show_match()
+		}, nil)
+		return false
+	case "n":
+		if len(ov.matches) > 0 {
+			ov.match = (ov.match + 1) % len(ov.matches)
+			ov.show_match()
+		}
+	case "N":
+		if len(ov.matches) > 0 {
+			ov.match = (ov.match - 1 + len(ov.matches)) % len(ov.matches)
+			ov.show_match()
+		}
+	case "p":
+		ov.open_in_pager()
+		return true
+	}
+	ov.render()
+	return false
+}
+
+// suspend the interface and show the output in $PAGER, opening the
+// files directly for finished jobs and piping bpeek output otherwise
+func (ov *outputViewer) open_in_pager() {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+
+	args := pager[1:]
+	files := output_file_paths(ov.job)
+	if is_job_running(ov.job) || len(files) == 0 {
+		files = nil
+	}
+	args = append(args, files...)
+
+	ui.Close()
+	pager_cmd := exec.Command(pager[0], args...)
+	if len(files) == 0 {
+		pager_cmd.Stdin = strings.NewReader(strings.Join(ov.lines, "\n") + "\n")
+	} else {
+		pager_cmd.Stdin = os.Stdin
+	}
+	pager_cmd.Stdout = os.Stdout
+	pager_cmd.Stderr = os.Stderr
+	err := pager_cmd.Run()
+
+	if init_err := ui.Init(); init_err != nil {
+		fmt.Println(init_err)
+		os.Exit(1)
+	}
+	if err != nil {
+		statusline.Text = "Error running pager: " + err.Error()
+		ui.Render(statusline_grid)
+	}
+}
+
+// whether LSF will give output for the job through bpeek
+func is_job_running(job recStruct) bool {
+	switch job.STAT {
+	case "RUN", "USUSP", "SSUSP":
+		return true
+	}
+	return false
+}
+
+// fetch a job's output, returning a description of its source and the text
+func fetch_job_output(job recStruct) (string, string, error) {
+	if is_job_running(job) {
+		bpeek_out, err := exec.Command("bpeek", job.JOBID).CombinedOutput()
+		return "bpeek", string(bpeek_out), err
+	}
+	if job.STAT == "PEND" || job.STAT == "PSUSP" {
+		return "pending", "Job has not started yet, so has no output", nil
+	}
+
+	files := output_file_paths(job)
+	if len(files) == 0 {
+		return "no output file", "bjobs reports no output or error file for this job", nil
+	}
+
+	var text strings.Builder
+	for i, path := range files {
+		content, err := read_file_tail(path, output_tail_bytes)
+		if err != nil {
+			return strings.Join(files, ", "), text.String(), err
+		}
+		// only label the files when both stdout and stderr are shown
+		if len(files) > 1 {
+			if i > 0 {
+				text.WriteString("\n")
+			}
+			text.WriteString("==> " + path + " <==\n")
+		}
+		text.WriteString(content)
+	}
+	return strings.Join(files, ", "), text.String(), nil
+}
+
+// resolved paths of the job's stdout and stderr files, without duplicates
+func output_file_paths(job recStruct) []string {
+	var files []string
+	for _, path := range []string{job.OUTPUT_FILE, job.ERROR_FILE} {
+		if path == "" {
+			continue
+		}
+		path = resolve_output_path(job, path)
+		if len(files) == 0 || files[0] != path {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// substitute the %J and %I placeholders bsub accepts in -o and -e paths,
+// and make relative paths relative to the job's execution directory
+func resolve_output_path(job recStruct, path string) string {
+	jobid := job.JOBID
+	array_index := "0"
+	if open := strings.Index(jobid, "["); open != -1 && strings.HasSuffix(jobid, "]") {
+		array_index = jobid[open+1 : len(jobid)-1]
+		jobid = jobid[:open]
+	}
+	path = strings.ReplaceAll(path, "%J", jobid)
+	path = strings.ReplaceAll(path, "%I", array_index)
+
+	if !filepath.IsAbs(path) && job.EXEC_CWD != "" {
+		path = filepath.Join(job.EXEC_CWD, path)
+	}
+	return path
+}
+
+// read at most max_bytes from the end of a file, dropping the partial
+// first line when the file had to be truncated
+func read_file_tail(path string, max_bytes int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	truncated := false
+	if info.Size() > max_bytes {
+		truncated = true
+		if _, err := f.Seek(info.Size()-max_bytes, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	text := string(content)
+	if truncated {
+		if newline := strings.Index(text, "\n"); newline != -1 {
+			text = text[newline+1:]
+		}
+	}
+	return text, nil
+}
+
+// split output into display lines, expanding tabs and carriage returns
+// which termui would otherwise draw as single cells
+func split_output_lines(text string) []string {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return []string{}
+	}
+	text = strings.ReplaceAll(text, "\t", "    ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		// keep only what a terminal would show after progress-bar style rewrites
+		if cr := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); cr != -1 {
+			line = line[cr+1:]
+		}
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines
+}
+
+func is_match(line string, search string) bool {
+	return strings.Contains(strings.ToLower(line), strings.ToLower(search))
+}
+
+// indexes of the lines containing the search term, ignoring case
+func find_matches(lines []string, search string) []int {
+	matches := []int{}
+	if search == "" {
+		return matches
+	}
+	for i, line := range lines {
+		if is_match(line, search) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that output paths have bsub placeholders substituted and are made absolute
+func TestResolveOutputPath(t *testing.T) {
+	job := recStruct{
+		JOBID:    "81061",
+		EXEC_CWD: "/lustre/scratch/project",
+	}
+
+	result := resolve_output_path(job, "logs/%J.out")
+	if result != "/lustre/scratch/project/logs/81061.out" {
+		t.Errorf("Expected relative path to be resolved against EXEC_CWD, got %s", result)
+	}
+
+	// absolute paths are left where they are
+	result = resolve_output_path(job, "/tmp/%J.err")
+	if result != "/tmp/81061.err" {
+		t.Errorf("Expected absolute path to be kept, got %s", result)
+	}
+
+	// array jobs substitute both the job id and the array index
+	array_job := recStruct{JOBID: "81062[7]"}
+	result = resolve_output_path(array_job, "/tmp/%J.%I.out")
+	if result != "/tmp/81062.7.out" {
+		t.Errorf("Expected array index to be substituted, got %s", result)
+	}
+}
+
+// Test that a job writing stdout and stderr to the same file only lists it once
+func TestOutputFilePaths(t *testing.T) {
+	job := recStruct{
+		JOBID:       "81061",
+		OUTPUT_FILE: "/tmp/81061.log",
+		ERROR_FILE:  "/tmp/%J.log",
+	}
+	files := output_file_paths(job)
+	if len(files) != 1 {
+		t.Errorf("Expected 1 output file when stdout and stderr are shared, got %d", len(files))
+	}
+
+	job.ERROR_FILE = "/tmp/%J.err"
+	files = output_file_paths(job)
+	if len(files) != 2 {
+		t.Errorf("Expected 2 output files, got %d", len(files))
+	}
+
+	if len(output_file_paths(recStruct{JOBID: "81061"})) != 0 {
+		t.Error("Expected no output files for a job without -o or -e")
+	}
+}
+
+// Test that finished jobs are read from their output files
+func TestFetchJobOutputFinished(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "bj_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ioutil.WriteFile(filepath.Join(tempDir, "81061.out"), []byte("step 1\nstep 2\n"), 0644)
+	ioutil.WriteFile(filepath.Join(tempDir, "81061.err"), []byte("Killed\n"), 0644)
+
+	job := recStruct{
+		JOBID:       "81061",
+		STAT:        "EXIT",
+		OUTPUT_FILE: "%J.out",
+		ERROR_FILE:  "%J.err",
+		EXEC_CWD:    tempDir,
+	}
+	_, text, err := fetch_job_output(job)
+	if err != nil {
+		t.Fatalf("Unexpected error reading output: %v", err)
+	}
+	if !strings.Contains(text, "step 2") || !strings.Contains(text, "Killed") {
+		t.Errorf("Expected both stdout and stderr in output, got %q", text)
+	}
+
+	// a missing file is reported rather than shown as empty output
+	job.OUTPUT_FILE = "missing.out"
+	if _, _, err := fetch_job_output(job); err == nil {
+		t.Error("Expected an error for a missing output file")
+	}
+}
+
+// Test that only the end of large files is read
+func TestReadFileTail(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "bj_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	testFile := filepath.Join(tempDir, "big.out")
+	ioutil.WriteFile(testFile, []byte("first line\nsecond line\nthird line\n"), 0644)
+
+	text, err := read_file_tail(testFile, 15)
+	if err != nil {
+		t.Fatalf("Unexpected error reading file: %v", err)
+	}
+	// the partial line cut by the byte limit is dropped
+	if text != "third line\n" {
+		t.Errorf("Expected only the last whole line, got %q", text)
+	}
+
+	text, _ = read_file_tail(testFile, 1024)
+	if !strings.HasPrefix(text, "first line") {
+		t.Errorf("Expected whole file when under the limit, got %q", text)
+	}
+}
+
+// Test splitting output into display lines
+func TestSplitOutputLines(t *testing.T) {
+	lines := split_output_lines("a\tb\nprogress 10%\rprogress 100%\r\nlast\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+	if lines[0] != "a    b" {
+		t.Errorf("Expected tabs to be expanded, got %q", lines[0])
+	}
+	if lines[1] != "progress 100%" {
+		t.Errorf("Expected only the last carriage-return rewrite, got %q", lines[1])
+	}
+
+	if len(split_output_lines("")) != 0 {
+		t.Error("Expected no lines for empty output")
+	}
+}
+
+// Test case-insensitive search over output lines
+func TestFindMatches(t *testing.T) {
+	lines := []string{"Starting", "ERROR: out of memory", "retrying", "error again"}
+
+	matches := find_matches(lines, "error")
+	if len(matches) != 2 || matches[0] != 1 || matches[1] != 3 {
+		t.Errorf("Expected matches on lines 1 and 3, got %v", matches)
+	}
+
+	if len(find_matches(lines, "")) != 0 {
+		t.Error("Expected no matches for an empty search")
+	}
+}
+
+// Test that output is read in the background and applied through
+// ui_updates, with only one read running at once
+func TestOutputViewerLoadsInBackground(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "81061.out"), []byte("[done](fg:red)\n"), 0644)
+	ov := &outputViewer{job: recStruct{JOBID: "81061", STAT: "DONE", OUTPUT_FILE: "%J.out", EXEC_CWD: dir}}
+
+	ov.load()
+	if !ov.loading {
+		t.Fatal("Expected the output to be loading")
+	}
+	ov.load()
+
+	select {
+	case update := <-ui_updates:
+		update()
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the output to be posted to ui_updates")
+	}
+	if ov.loading || len(ov.lines) != 1 || ov.lines[0] != "[done](fg:red)" {
+		t.Errorf("Expected the output to have been read, got loading %v lines %v", ov.loading, ov.lines)
+	}
+	select {
+	case <-ui_updates:
+		t.Error("Expected a second load not to start while the first was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
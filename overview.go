@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// projectSummary is a row of the overview, counting a project's jobs
+type projectSummary struct {
+	project string
+	counts  map[string]int
+	total   int
+	alerts  int
+	// seconds until the last running job reaches its run limit, 0 when
+	// no running job has one
+	eta int
+}
+
+// time left before the run limit in seconds, from TIME_LEFT values like
+// "47:51 L" in hours and minutes, false when the job has no run limit
+func (rec recStruct) time_left_seconds() (int, bool) {
+	time_left := strings.TrimSpace(strings.Replace(rec.TIME_LEFT, " L", "", 1))
+	parts := strings.Split(time_left, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	return hours*3600 + minutes*60, true
+}
+
+// every job of the user, grouped by the project (-Jd) it was submitted with
+func run_bjobs_overview() (map[string][]recStruct, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("bjobs", "-a", "-json", "-o", bjobs_fields)
+	cmd.Stderr = &stderr
+	bjobsJson, err := cmd.Output()
+	// bjobs exits with an error when there are no jobs, but still prints JSON
+	if err != nil && len(bjobsJson) == 0 {
+		return nil, fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parse_overview_json(bjobsJson)
+}
+
+func parse_overview_json(bjobsJson []byte) (map[string][]recStruct, error) {
+	var bjobsResponse struct {
+		Records []recStruct `json:"RECORDS"`
+	}
+	if err := json.Unmarshal(bjobsJson, &bjobsResponse); err != nil {
+		return nil, err
+	}
+	projects := make(map[string][]recStruct)
+	for _, record := range bjobsResponse.Records {
+		projects[record.JOB_DESCRIPTION] = append(projects[record.JOB_DESCRIPTION], record)
+	}
+	return projects, nil
+}
+
+// the resource histories kept for the project being shown and those open
+// in tabs, for predicting which of their jobs will reach a limit
+func project_histories() map[string][]resourceSample {
+	histories := make(map[string][]resourceSample)
+	for _, tab := range append(project_tabs, &projectTab{history: resource_history}) {
+		for id, samples := range tab.history {
+			histories[id] = samples
+		}
+	}
+	return histories
+}
+
+// summarise each project's jobs, most urgent first: those with jobs near
+// their limits, then those with the most EXIT jobs, then the busiest
+func summarise_projects(projects map[string][]recStruct, histories map[string][]resourceSample) []projectSummary {
+	var summaries []projectSummary
+	for project, jobs := range projects {
+		summary := projectSummary{project: project, counts: make(map[string]int), total: len(jobs)}
+		for _, job := range jobs {
+			summary.counts[job.STAT]++
+			if alert, _ := job_alert(job, histories[job.JOBID]); alert != "" {
+				summary.alerts++
+			}
+			if seconds, ok := job.time_left_seconds(); ok && job.STAT == "RUN" && seconds > summary.eta {
+				summary.eta = seconds
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i int, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.alerts != b.alerts {
+			return a.alerts > b.alerts
+		}
+		if a.counts["EXIT"] != b.counts["EXIT"] {
+			return a.counts["EXIT"] > b.counts["EXIT"]
+		}
+		if a.counts["RUN"] != b.counts["RUN"] {
+			return a.counts["RUN"] > b.counts["RUN"]
+		}
+		return a.project < b.project
+	})
+	return summaries
+}
+
+// percentage of the project's jobs that have finished
+func (summary projectSummary) percent_complete() float64 {
+	if summary.total == 0 {
+		return 0
+	}
+	return float64(summary.counts["DONE"]+summary.counts["EXIT"]) / float64(summary.total) * 100
+}
+
+func (summary projectSummary) line() string {
+	name := summary.project
+	if name == "" {
+		name = "(no project)"
+	}
+	if name_rune := []rune(name); len(name_rune) > 30 {
+		name = string(name_rune[:27]) + "..."
+	}
+	eta := "-"
+	if summary.eta > 0 {
+		eta = format_duration(summary.eta)
+		// pending jobs will still need to run once these reach their limit
+		if summary.counts["PEND"] > 0 {
+			eta += "+"
+		}
+	}
+	return fmt.Sprintf("%-30s %6d %6d %6d %6d %6.0f%% %6d  %s", name, summary.counts["RUN"], summary.counts["PEND"],
+		summary.counts["DONE"], summary.counts["EXIT"], summary.percent_complete(), summary.alerts, eta)
+}
+
+// the overview of every project with jobs, calling on_pick with the
+// project chosen to drill into
+func open_overview(on_pick func(project string)) {
+	projects, err := run_bjobs_overview()
+	summaries := summarise_projects(projects, project_histories())
+
+	lines := []string{fmt.Sprintf("[%-30s %6s %6s %6s %6s %7s %6s  %s](fg:yellow,mod:bold)", "PROJECT", "RUN", "PEND", "DONE", "EXIT", "DONE%", "ALERTS", "ETA"), ""}
+	if err != nil {
+		lines[1] = "Error fetching jobs: " + err.Error()
+	}
+	for _, summary := range summaries {
+		lines = append(lines, summary.line())
+	}
+
+	m := open_modal("Projects", lines, "Show project [Enter]  Refresh [r]  Close [O] ", nil)
+	m.on_key = func(key string) bool {
+		switch key {
+		case "<Enter>":
+			if len(summaries) > 0 {
+				// jobs of no project can't be asked for with -Jd, so all jobs are shown for them
+				on_pick(summaries[m.selected-m.first_choice].project)
+			}
+			return true
+		case "r":
+			open_overview(on_pick)
+			return false
+		case "O", "q", "<Escape>":
+			return true
+		}
+		return false
+	}
+	m.full = true
+	m.selectable = true
+	m.first_choice = 2
+	m.move_selection(0)
+	m.render()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimeLeftSeconds(t *testing.T) {
+	tests := []struct {
+		time_left string
+		expected  int
+		ok        bool
+	}{
+		{"47:51 L", 47*3600 + 51*60, true},
+		{"0:05 L", 300, true},
+		{"", 0, false},
+		{"-", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := recStruct{TIME_LEFT: tt.time_left}.time_left_seconds()
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("time_left_seconds(%q) = %d, %v, expected %d, %v", tt.time_left, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestSummariseProjects(t *testing.T) {
+	projects, err := parse_overview_json([]byte(read_fixture(t, "test/data/jobs_overview.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 4 || len(projects["fq compression"]) != 3 || projects["alignment"][0].EXIT_REASON != "TERM_MEMLIMIT" {
+		t.Fatalf("Expected jobs grouped by project with their fields, got %v", projects)
+	}
+
+	summaries := summarise_projects(projects, nil)
+	var order []string
+	for _, summary := range summaries {
+		order = append(order, summary.project)
+	}
+	// alerts first, then EXIT jobs, then running jobs
+	if strings.Join(order, "|") != "variant calling|alignment||fq compression" {
+		t.Errorf("Unexpected urgency order %q", order)
+	}
+
+	fq := summaries[3]
+	if fq.counts["RUN"] != 1 || fq.counts["PEND"] != 1 || fq.counts["DONE"] != 1 || fq.eta != 9000 {
+		t.Errorf("Unexpected summary %+v", fq)
+	}
+	if got := fq.percent_complete(); got < 33 || got > 34 {
+		t.Errorf("Expected a third of the jobs complete, got %.1f", got)
+	}
+	if line := fq.line(); !strings.HasPrefix(line, "fq compression") || !strings.HasSuffix(line, "2h 30m+") {
+		t.Errorf("Unexpected line %q", line)
+	}
+	if line := summaries[2].line(); !strings.HasPrefix(line, "(no project)") || !strings.HasSuffix(line, " -") {
+		t.Errorf("Unexpected line for jobs of no project %q", line)
+	}
+	if summaries[0].alerts != 1 || summaries[1].percent_complete() != 100 {
+		t.Errorf("Unexpected summaries %+v %+v", summaries[0], summaries[1])
+	}
+}
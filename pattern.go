@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// marks a project given by the user as a glob
+const glob_prefix = "glob:"
+
+// whether a project is a pattern matching several projects rather than a
+// project name bjobs -Jd can be given: a regular expression between
+// slashes, like /fqcomp_batch_[0-9]+/, or a glob marked as one, like
+// glob:fqcomp_batch_*. Globs need marking so that project names with
+// "*", "?" or "[" in them, like align[1-100], are still taken as they are
+func is_project_pattern(project string) bool {
+	return is_regexp_pattern(project) || is_glob_pattern(project)
+}
+
+func is_regexp_pattern(project string) bool {
+	return len(project) > 2 && strings.HasPrefix(project, "/") && strings.HasSuffix(project, "/")
+}
+
+func is_glob_pattern(project string) bool {
+	return len(project) > len(glob_prefix) && strings.HasPrefix(project, glob_prefix)
+}
+
+// compile a project pattern into a regular expression matching the whole
+// of a project name, with globs matching "/" like any other character
+func project_regexp(pattern string) (*regexp.Regexp, error) {
+	if is_regexp_pattern(pattern) {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+
+	expr := "^"
+	glob := []rune(strings.TrimPrefix(pattern, glob_prefix))
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			expr += ".*"
+		case '?':
+			expr += "."
+		case '[':
+			// copy character classes across, with [!a-c] negated like [^a-c]
+			end := i + 1
+			for end < len(glob) && glob[end] != ']' {
+				end++
+			}
+			if end == len(glob) {
+				expr += regexp.QuoteMeta("[")
+				continue
+			}
+			class := string(glob[i+1 : end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + class + "]"
+			i = end
+		default:
+			expr += regexp.QuoteMeta(string(glob[i]))
+		}
+	}
+	return regexp.Compile(expr + "$")
+}
+
+// the jobs whose project matches a pattern, none when it doesn't compile
+func filter_project_jobs(jobs map[string]recStruct, pattern string) map[string]recStruct {
+	matching := make(map[string]recStruct)
+	project_match, err := project_regexp(pattern)
+	if err != nil {
+		return matching
+	}
+	for id, job := range jobs {
+		if job.JOB_DESCRIPTION != "" && project_match.MatchString(job.JOB_DESCRIPTION) {
+			matching[id] = job
+		}
+	}
+	return matching
+}
+
+// check a project given by the user, returning an error for a pattern
+// that won't compile
+func check_project(project string) error {
+	if !is_project_pattern(project) {
+		return nil
+	}
+	_, err := project_regexp(project)
+	return err
+}
+
+// the number of different projects the jobs come from
+func count_projects(db map[string]recStruct, ids []string) int {
+	projects := make(map[string]bool)
+	for _, id := range ids {
+		projects[db[id].JOB_DESCRIPTION] = true
+	}
+	return len(projects)
+}
+
+// whether the jobs shown come from several projects, which are then listed
+// in their own column and grouped together in the table
+func showing_several_projects() bool {
+	return projectBool && is_project_pattern(proj_name)
+}
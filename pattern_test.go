@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestProjectRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"glob:fqcomp_batch_*", "fqcomp_batch_01", true},
+		{"glob:fqcomp_batch_*", "fqcomp_batch_40", true},
+		{"glob:fqcomp_batch_*", "other_fqcomp_batch_01", false},
+		{"glob:fqcomp_batch_0?", "fqcomp_batch_07", true},
+		{"glob:fqcomp_batch_0?", "fqcomp_batch_10", false},
+		{"glob:run_[0-3]", "run_2", true},
+		{"glob:run_[!0-3]", "run_2", false},
+		{"glob:run_[!0-3]", "run_5", true},
+		{"glob:a/*", "a/b/c", true},
+		{"glob:v1.*", "v1.2", true},
+		{"glob:v1.*", "v102", false},
+		{"/^fqcomp_batch_[0-9]+$/", "fqcomp_batch_12", true},
+		{"/batch/", "fqcomp_batch_12", true},
+		{"/^batch/", "fqcomp_batch_12", false},
+	}
+	for _, tt := range tests {
+		project_match, err := project_regexp(tt.pattern)
+		if err != nil {
+			t.Errorf("project_regexp(%q) gave error %v", tt.pattern, err)
+			continue
+		}
+		if got := project_match.MatchString(tt.name); got != tt.matches {
+			t.Errorf("pattern %q matching %q = %v, expected %v", tt.pattern, tt.name, got, tt.matches)
+		}
+	}
+}
+
+func TestIsProjectPattern(t *testing.T) {
+	tests := []struct {
+		project  string
+		expected bool
+	}{
+		{"fq compression", false},
+		{"a/b", false},
+		{"/", false},
+		{"glob:fqcomp_*", true},
+		{"glob:run_[12]", true},
+		{"/fqcomp/", true},
+		// unmarked names with glob characters are project names
+		{"fqcomp_*", false},
+		{"align[1-100]", false},
+		{"glob:", false},
+	}
+	for _, tt := range tests {
+		if got := is_project_pattern(tt.project); got != tt.expected {
+			t.Errorf("is_project_pattern(%q) = %v, expected %v", tt.project, got, tt.expected)
+		}
+	}
+	if check_project("/fqcomp_(/") == nil || check_project("glob:fqcomp_*") != nil || check_project("plain") != nil {
+		t.Error("Expected only the pattern that doesn't compile to be refused")
+	}
+}
+
+func TestFilterProjectJobs(t *testing.T) {
+	jobs := map[string]recStruct{
+		"1": {JOBID: "1", JOB_DESCRIPTION: "fqcomp_batch_01"},
+		"2": {JOBID: "2", JOB_DESCRIPTION: "fqcomp_batch_02"},
+		"3": {JOBID: "3", JOB_DESCRIPTION: "alignment"},
+		"4": {JOBID: "4"},
+	}
+	matching := filter_project_jobs(jobs, "glob:fqcomp_batch_*")
+	if len(matching) != 2 || matching["1"].JOBID != "1" || matching["2"].JOBID != "2" {
+		t.Errorf("Expected the two batch jobs, got %v", matching)
+	}
+	if matching := filter_project_jobs(jobs, "/*/"); len(matching) != 0 {
+		t.Errorf("Expected no jobs for a pattern that doesn't compile, got %v", matching)
+	}
+	if got := count_projects(jobs, []string{"1", "2", "3"}); got != 3 {
+		t.Errorf("Expected 3 projects, got %d", got)
+	}
+
+	pending, err := filter_pending_jobs([]pendingJob{{JOBID: "1", JOB_DESCRIPTION: "fqcomp_batch_01"}, {JOBID: "3", JOB_DESCRIPTION: "alignment"}}, "glob:fqcomp_*")
+	if err != nil || len(pending) != 1 || pending[0].JOBID != "1" {
+		t.Errorf("Expected the pending batch job, got %v %v", pending, err)
+	}
+}
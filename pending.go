@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// number of the longest-waiting jobs listed in the pending panel
+const longest_waiting_count = 20
+
+// pendingJob is a pending job with the reason LSF gives for not starting it
+type pendingJob struct {
+	JOBID       string
+	QUEUE       string
+	PEND_REASON string
+	PEND_TIME   string
+	// the job's project, for picking out the jobs of a project pattern
+	JOB_DESCRIPTION string
+}
+
+// reasonCount is the number of pending jobs held back by one reason
+type reasonCount struct {
+	reason string
+	count  int
+}
+
+// matches the host counts LSF appends to reasons, e.g. ": 120 hosts"
+var pend_hosts_regex = regexp.MustCompile(`:\s*\d+ hosts?$`)
+
+// pendingPanel lists why pending jobs are waiting and which have waited longest
+type pendingPanel struct {
+	pane *widgets.Paragraph
+	jobs []pendingJob
+	err  error
+	// first line shown, for scrolling through more reasons than fit
+	offset int
+	// bjobs -p is running in the background, and whether it has finished once
+	loading bool
+	loaded  bool
+}
+
+// the pending panel currently open, nil when the job table is showing
+var pending_view *pendingPanel
+
+func open_pending_view() {
+	pending_view = &pendingPanel{pane: widgets.NewParagraph()}
+	pending_view.pane.TitleStyle.Fg = ColorYellow
+	pending_view.pane.BorderStyle.Fg = ColorBlue
+	pending_view.pane.WrapText = false
+	pending_view.load()
+	pending_view.render()
+}
+
+// fetch the pending jobs in the background, as bjobs -p can be slow, with
+// the panel drawn again once they arrive. A load still running is left
+// to finish rather than starting another
+func (pv *pendingPanel) load() {
+	if pv.loading {
+		return
+	}
+	pv.loading = true
+	project := ""
+	if projectBool {
+		project = proj_name
+	}
+	go func() {
+		jobs, err := run_bjobs_pending(project)
+		ui_updates <- func() {
+			pv.jobs, pv.err = jobs, err
+			pv.loading, pv.loaded = false, true
+		}
+	}()
+}
+
+// fetch the pending reason and time for each pending job of a project,
+// or of every project when it's empty
+func run_bjobs_pending(project string) ([]pendingJob, error) {
+	args := []string{"-p", "-json", "-o", "jobid queue pend_reason pend_time job_description"}
+	if project != "" && !is_project_pattern(project) {
+		args = append([]string{"-Jd", project}, args...)
+	}
+	bjobsJson, err := exec.Command("bjobs", args...).Output()
+	// bjobs exits with an error when nothing is pending, but still prints JSON
+	if err != nil && len(bjobsJson) == 0 {
+		return nil, err
+	}
+	jobs, err := parse_pending_json(bjobsJson)
+	if err != nil || project == "" || !is_project_pattern(project) {
+		return jobs, err
+	}
+	return filter_pending_jobs(jobs, project)
+}
+
+// the pending jobs whose project matches a pattern
+func filter_pending_jobs(jobs []pendingJob, pattern string) ([]pendingJob, error) {
+	project_match, err := project_regexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matching []pendingJob
+	for _, job := range jobs {
+		if job.JOB_DESCRIPTION != "" && project_match.MatchString(job.JOB_DESCRIPTION) {
+			matching = append(matching, job)
+		}
+	}
+	return matching, nil
+}
+
+func parse_pending_json(bjobsJson []byte) ([]pendingJob, error) {
+	var bjobsResponse struct {
+		Records []pendingJob `json:"RECORDS"`
+	}
+	if err := json.Unmarshal(bjobsJson, &bjobsResponse); err != nil {
+		return nil, err
+	}
+	return bjobsResponse.Records, nil
+}
+
+// split LSF's pending reason into its separate reasons, without host counts
+func pend_reasons(pend_reason string) []string {
+	var reasons []string
+	for _, reason := range strings.Split(pend_reason, ";") {
+		reason = strings.TrimSpace(pend_hosts_regex.ReplaceAllString(strings.TrimSpace(reason), ""))
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "No reason given")
+	}
+	return reasons
+}
+
+// count the jobs held back by each reason, most common first, counting
+// a job once under each of the reasons it gives
+func group_pend_reasons(jobs []pendingJob) []reasonCount {
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		for _, reason := range pend_reasons(job.PEND_REASON) {
+			counts[reason]++
+		}
+	}
+
+	var grouped []reasonCount
+	for reason, count := range counts {
+		grouped = append(grouped, reasonCount{reason, count})
+	}
+	sort.Slice(grouped, func(i int, j int) bool {
+		if grouped[i].count != grouped[j].count {
+			return grouped[i].count > grouped[j].count
+		}
+		return grouped[i].reason < grouped[j].reason
+	})
+	return grouped
+}
+
+// seconds a job has been pending, from PEND_TIME values like "86400"
+func pend_seconds(job pendingJob) int {
+	seconds, _ := strconv.Atoi(strings.TrimSpace(strings.Replace(job.PEND_TIME, "second(s)", "", 1)))
+	return seconds
+}
+
+// the n jobs that have been pending longest
+func longest_waiting(jobs []pendingJob, n int) []pendingJob {
+	sorted := append([]pendingJob{}, jobs...)
+	sort.SliceStable(sorted, func(i int, j int) bool { return pend_seconds(sorted[i]) > pend_seconds(sorted[j]) })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// a compact duration like "2d 3h", "45m" or "30s"
+func format_duration(seconds int) string {
+	switch {
+	case seconds >= 86400:
+		return fmt.Sprintf("%dd %dh", seconds/86400, seconds%86400/3600)
+	case seconds >= 3600:
+		return fmt.Sprintf("%dh %dm", seconds/3600, seconds%3600/60)
+	case seconds >= 60:
+		return fmt.Sprintf("%dm", seconds/60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// the panel's lines, every reason and the longest waiting jobs
+func (pv *pendingPanel) lines() []string {
+	var lines []string
+	if !pv.loaded {
+		lines = append(lines, "Fetching pending jobs...")
+	} else if pv.err != nil {
+		lines = append(lines, "Error fetching pending jobs: "+pv.err.Error())
+	} else if len(pv.jobs) == 0 {
+		lines = append(lines, "No pending jobs")
+	} else {
+		lines = append(lines, "[Why "+strconv.Itoa(len(pv.jobs))+" jobs are pending](fg:yellow,mod:bold)")
+		for _, reason := range group_pend_reasons(pv.jobs) {
+			lines = append(lines, fmt.Sprintf("%7d  %s", reason.count, reason.reason))
+		}
+
+		lines = append(lines, "", "[Longest waiting](fg:yellow,mod:bold)")
+		lines = append(lines, fmt.Sprintf("%-12s %-10s %-9s %s", "JOB ID", "QUEUE", "WAITING", "REASON"))
+		for _, job := range longest_waiting(pv.jobs, longest_waiting_count) {
+			lines = append(lines, fmt.Sprintf("%-12s %-10s %-9s %s", job.JOBID, job.QUEUE, format_duration(pend_seconds(job)), strings.Join(pend_reasons(job.PEND_REASON), "; ")))
+		}
+	}
+
+	return lines
+}
+
+func (pv *pendingPanel) height() int {
+	return termHeight - 3 - 2
+}
+
+func (pv *pendingPanel) render() {
+	pv.pane.SetRect(0, 0, termWidth, termHeight-3)
+
+	// show the lines that fit from the scroll offset rather than letting termui wrap them
+	lines := pv.lines()
+	if pv.offset > len(lines)-pv.height() {
+		pv.offset = len(lines) - pv.height()
+	}
+	if pv.offset < 0 {
+		pv.offset = 0
+	}
+	end := pv.offset + pv.height()
+	if end > len(lines) {
+		end = len(lines)
+	}
+	pv.pane.Title = " Pending jobs "
+	if len(lines) > pv.height() {
+		pv.pane.Title = fmt.Sprintf(" Pending jobs [%d-%d/%d] ", pv.offset+1, end, len(lines))
+	}
+	pv.pane.Text = strings.Join(lines[pv.offset:end], "\n")
+	ui.Render(pv.pane)
+}
+
+// handle a key press while the panel is open, returning true when it
+// has been closed and the job table underneath needs redrawing
+func (pv *pendingPanel) handle_event(e ui.Event) bool {
+	switch e.ID {
+	case "p", "q", "<Escape>":
+		pending_view = nil
+		return true
+	case "r":
+		pv.load()
+	case "<Up>":
+		pv.offset--
+	case "<Down>":
+		pv.offset++
+	case "<PageUp>":
+		pv.offset -= pv.height()
+	case "<PageDown>":
+		pv.offset += pv.height()
+	}
+	pv.render()
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func readPendingFixture(t *testing.T) []pendingJob {
+	data, err := ioutil.ReadFile("test/data/jobs_pending_reasons.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	jobs, err := parse_pending_json(data)
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	return jobs
+}
+
+// Test splitting LSF pending reasons and removing host counts
+func TestPendReasons(t *testing.T) {
+	reasons := pend_reasons("Not enough memory on hosts: 120 hosts; Job slot limit reached;")
+	if len(reasons) != 2 {
+		t.Fatalf("Expected 2 reasons, got %d: %v", len(reasons), reasons)
+	}
+	if reasons[0] != "Not enough memory on hosts" {
+		t.Errorf("Expected host count to be removed, got %q", reasons[0])
+	}
+
+	if reasons := pend_reasons(""); len(reasons) != 1 || reasons[0] != "No reason given" {
+		t.Errorf("Expected a placeholder for an empty reason, got %v", reasons)
+	}
+}
+
+// Test grouping pending jobs by reason
+func TestGroupPendReasons(t *testing.T) {
+	grouped := group_pend_reasons(readPendingFixture(t))
+
+	expected := []reasonCount{
+		{"Job slot limit reached", 3},
+		{"Not enough memory on hosts", 2},
+		{"Job dependency condition not satisfied", 1},
+	}
+	if len(grouped) != len(expected) {
+		t.Fatalf("Expected %d reasons, got %d: %v", len(expected), len(grouped), grouped)
+	}
+	for i := range expected {
+		if grouped[i] != expected[i] {
+			t.Errorf("Expected reason %d to be %v, got %v", i, expected[i], grouped[i])
+		}
+	}
+}
+
+// Test listing the jobs that have waited longest
+func TestLongestWaiting(t *testing.T) {
+	jobs := longest_waiting(readPendingFixture(t), 3)
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(jobs))
+	}
+	if jobs[0].JOBID != "90001" || jobs[1].JOBID != "90004" || jobs[2].JOBID != "90002" {
+		t.Errorf("Unexpected order of longest waiting jobs: %v", jobs)
+	}
+}
+
+// Test formatting of pending durations
+func TestFormatDuration(t *testing.T) {
+	cases := map[int]string{
+		45:     "45s",
+		600:    "10m",
+		7260:   "2h 1m",
+		183600: "2d 3h",
+	}
+	for seconds, expected := range cases {
+		if result := format_duration(seconds); result != expected {
+			t.Errorf("Expected %d seconds to be %q, got %q", seconds, expected, result)
+		}
+	}
+}
+
+// Test that the panel keeps every reason for scrolling to, rather than
+// dropping those past its height
+func TestPendingPanelLines(t *testing.T) {
+	pv := &pendingPanel{}
+	if lines := pv.lines(); len(lines) != 1 || lines[0] != "Fetching pending jobs..." {
+		t.Errorf("Expected the panel to show it's fetching before the first load, got %v", lines)
+	}
+
+	var jobs []pendingJob
+	for i := 0; i < 50; i++ {
+		jobs = append(jobs, pendingJob{JOBID: strconv.Itoa(i), PEND_REASON: "Reason " + strconv.Itoa(i)})
+	}
+	pv.jobs, pv.loaded = jobs, true
+	termHeight = 20
+	// a heading and the 50 reasons, then a blank line, two headings and the longest waiting jobs
+	if lines := pv.lines(); len(lines) != 1+50+3+longest_waiting_count {
+		t.Errorf("Expected every reason to be listed, got %d lines", len(lines))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+// number of recent samples a job's usage is extrapolated from, enough to
+// smooth over noise while still reacting to a change in behaviour
+const predict_samples = 10
+
+// seconds until the values reach the limit if they keep rising at the rate
+// fitted to the recent samples, false when they aren't rising or there
+// aren't enough samples to tell
+func seconds_to_limit(times []float64, values []float64, limit float64) (float64, bool) {
+	if len(values) > predict_samples {
+		times = times[len(times)-predict_samples:]
+		values = values[len(values)-predict_samples:]
+	}
+	if len(values) < 3 || limit <= 0 {
+		return 0, false
+	}
+
+	// least squares slope, which a single noisy poll can't swing as much as
+	// a straight line between the first and last sample
+	var mean_t, mean_v float64
+	for i := range values {
+		mean_t += times[i]
+		mean_v += values[i]
+	}
+	mean_t /= float64(len(values))
+	mean_v /= float64(len(values))
+	var covariance, variance float64
+	for i := range values {
+		covariance += (times[i] - mean_t) * (values[i] - mean_v)
+		variance += (times[i] - mean_t) * (times[i] - mean_t)
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	slope := covariance / variance
+	if slope <= 0 {
+		return 0, false
+	}
+
+	latest := values[len(values)-1]
+	if latest >= limit {
+		return 0, true
+	}
+	return (limit - latest) / slope, true
+}
+
+// describe when a running job is projected to reach its memory or run
+// limit, empty when it isn't expected to within horizon seconds
+func predict_limit(job recStruct, samples []resourceSample, horizon int) string {
+	if horizon <= 0 || job.STAT != "RUN" {
+		return ""
+	}
+	var times, mems, completes []float64
+	for _, sample := range samples {
+		times = append(times, float64(sample.Time))
+		mems = append(mems, sample.Mem)
+		completes = append(completes, sample.Complete)
+	}
+
+	// report whichever limit would be reached first
+	prediction := ""
+	soonest := float64(horizon)
+	memlimit := parse_human_sizes(parse_bytes_output(job.MEMLIMIT))
+	if seconds, ok := seconds_to_limit(times, mems, memlimit); ok && seconds <= soonest {
+		soonest = seconds
+		prediction = "memory"
+	}
+	if job.COMPLETE != "" {
+		if seconds, ok := seconds_to_limit(times, completes, 100); ok && seconds <= soonest {
+			soonest = seconds
+			prediction = "time"
+		}
+	}
+	if prediction == "" {
+		return ""
+	}
+	return "predicted to reach " + prediction + " limit in " + format_duration(int(soonest))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSecondsToLimit(t *testing.T) {
+	times := []float64{0, 30, 60, 90}
+
+	seconds, ok := seconds_to_limit(times, []float64{10, 20, 30, 40}, 100)
+	if !ok || seconds != 180 {
+		t.Errorf("Expected 180 seconds to the limit, got %v %v", seconds, ok)
+	}
+	if _, ok := seconds_to_limit(times, []float64{40, 30, 20, 10}, 100); ok {
+		t.Error("Expected no prediction for falling usage")
+	}
+	if _, ok := seconds_to_limit(times, []float64{40, 40, 40, 40}, 100); ok {
+		t.Error("Expected no prediction for flat usage")
+	}
+	if _, ok := seconds_to_limit(times[:2], []float64{10, 20}, 100); ok {
+		t.Error("Expected no prediction from only two samples")
+	}
+	if _, ok := seconds_to_limit(times, []float64{10, 20, 30, 40}, 0); ok {
+		t.Error("Expected no prediction without a limit")
+	}
+	if seconds, ok := seconds_to_limit(times, []float64{70, 90, 110, 130}, 100); !ok || seconds != 0 {
+		t.Errorf("Expected 0 seconds once past the limit, got %v %v", seconds, ok)
+	}
+}
+
+func TestSecondsToLimitUsesRecentSamples(t *testing.T) {
+	// a job that was flat for a long time then started climbing
+	var times, values []float64
+	for i := 0; i < 30; i++ {
+		times = append(times, float64(i*30))
+		if i < 20 {
+			values = append(values, 10)
+		} else {
+			values = append(values, 10+float64(i-19)*10)
+		}
+	}
+	seconds, ok := seconds_to_limit(times, values, 200)
+	if !ok || seconds > 300 {
+		t.Errorf("Expected the recent climb to predict the limit within 300 seconds, got %v %v", seconds, ok)
+	}
+}
+
+func climbing_samples(mems []float64, completes []float64) []resourceSample {
+	var samples []resourceSample
+	for i := range mems {
+		samples = append(samples, resourceSample{Time: int64(i * sample_interval), Mem: mems[i], Complete: completes[i]})
+	}
+	return samples
+}
+
+func TestPredictLimit(t *testing.T) {
+	job := recStruct{JOBID: "100", STAT: "RUN", MEMLIMIT: "10 G", COMPLETE: "50.00% L"}
+
+	// memory climbing 1G a sample reaches 10G in 2 samples
+	mem_samples := climbing_samples([]float64{5e9, 6e9, 7e9, 8e9}, []float64{47, 48, 49, 50})
+	if got, expected := predict_limit(job, mem_samples, 1800), "predicted to reach memory limit in 1m"; got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+
+	// %complete climbing 10% a sample reaches 100% well before memory does
+	time_samples := climbing_samples([]float64{1e9, 1e9, 1e9, 1e9}, []float64{60, 70, 80, 90})
+	if got, expected := predict_limit(job, time_samples, 1800), "predicted to reach time limit in 30s"; got != expected {
+		t.Errorf("Got %q, expected %q", got, expected)
+	}
+
+	// outside the horizon, or with predictions turned off
+	if got := predict_limit(job, mem_samples, 30); got != "" {
+		t.Errorf("Expected no prediction beyond the horizon, got %q", got)
+	}
+	if got := predict_limit(job, mem_samples, 0); got != "" {
+		t.Errorf("Expected no prediction with a zero horizon, got %q", got)
+	}
+
+	job.STAT = "DONE"
+	if got := predict_limit(job, mem_samples, 1800); got != "" {
+		t.Errorf("Expected no prediction for a finished job, got %q", got)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+// longest encoded project name used as a file name as is, longer ones are
+// shortened with a hash so they stay within filesystem limits
+const max_project_file_name = 200
+
+// the index of every project bj has cached, in the config directory
+const project_index_file = "projects.db"
+
+var projects_bucket = []byte("projects")
+
+// seconds after which a project's last seen time is written to the index
+// again even though its counts haven't changed
+const project_index_interval = 300
+
+// what was last written to each index for each project, keyed by the
+// index's directory and the project's store name
+var indexed_projects = make(map[string]projectEntry)
+var indexed_projects_lock sync.Mutex
+
+// projectEntry is a project in the index, with its job counts when last seen
+type projectEntry struct {
+	Name     string         `json:"name"`
+	LastSeen int64          `json:"last_seen"`
+	Counts   map[string]int `json:"counts"`
+}
+
+// encode a project name into a file name that can't leave the projects
+// directory, keeping letters, digits, "_" and "-" and escaping the rest
+// like a URL, e.g. "fq compression/1" becomes "fq%20compression%2F1"
+func encode_project_name(project string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(project) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '_', b == '-':
+			encoded.WriteByte(b)
+		case b == '.' && encoded.Len() > 0:
+			// a leading dot would hide the file, or make ".." a name
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	name := encoded.String()
+	if len(name) > max_project_file_name {
+		sum := sha1.Sum([]byte(project))
+		name = name[:max_project_file_name-17] + "-" + hex.EncodeToString(sum[:])[:16]
+	}
+	return name
+}
+
+// a project's store relative to the config directory, with jobs not
+// filtered by a project keeping the store in the config directory itself
+func project_store_name(project string) string {
+	if project == "" {
+		return "history.db"
+	}
+	return "projects/" + encode_project_name(project) + ".db"
+}
+
+func project_store_path(project string) string {
+	return config_dir() + project_store_name(project)
+}
+
+// a file earlier versions of bj kept for a project by appending its name
+// to the config directory, false when that path would be outside it
+func legacy_project_path(project string, file_name string) (string, bool) {
+	path := filepath.Clean(config_dir() + project + file_name)
+	rel, err := filepath.Rel(filepath.Clean(config_dir()), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return path, true
+}
+
+// the path of a project's store, moving and importing the caches earlier
+// versions of bj kept for it
+func prepare_project_store(project string) (string, error) {
+	usr_config := project_store_path(project)
+	if err := os.MkdirAll(filepath.Dir(usr_config), 0755); err != nil {
+		return usr_config, err
+	}
+
+	// stores were named after the project before names were encoded
+	if old_store, ok := legacy_project_path(project, "history.db"); ok && old_store != usr_config {
+		if _, err := os.Stat(usr_config); os.IsNotExist(err) {
+			if _, err := os.Stat(old_store); err == nil {
+				if err := os.Rename(old_store, usr_config); err != nil {
+					return usr_config, err
+				}
+				old_archive := archive_dir(old_store)
+				if _, err := os.Stat(old_archive); err == nil {
+					if err := os.Rename(old_archive, archive_dir(usr_config)); err != nil {
+						return usr_config, err
+					}
+				}
+			}
+		}
+	}
+
+	legacy_cache, cache_ok := legacy_project_path(project, "savedDatabase.json")
+	legacy_history, history_ok := legacy_project_path(project, "savedHistory.json")
+	if cache_ok && history_ok {
+		return usr_config, migrate_json_cache(project, usr_config, legacy_cache, legacy_history)
+	}
+	return usr_config, nil
+}
+
+// count a project's jobs by status
+func count_jobs(db map[string]recStruct) map[string]int {
+	counts := make(map[string]int)
+	for _, job := range db {
+		counts[job.STAT]++
+	}
+	return counts
+}
+
+// record when a project was last seen and how many of its jobs are in each
+// state. The index is shared by every bj instance, so it's only written when
+// the counts have changed or the last write is project_index_interval old
+func update_project_index(usr_home string, project string, db map[string]recStruct, now int64) error {
+	entry := projectEntry{Name: project, LastSeen: now, Counts: count_jobs(db)}
+	// keyed by store as bbolt keys can't be empty like the project can
+	key := project_store_name(project)
+
+	indexed_projects_lock.Lock()
+	defer indexed_projects_lock.Unlock()
+	last, ok := indexed_projects[filepath.Join(usr_home, key)]
+	if ok && reflect.DeepEqual(last.Counts, entry.Counts) && now-last.LastSeen < project_index_interval {
+		return nil
+	}
+	err := with_project_index(usr_home, true, func(b *bolt.Bucket) error {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+	if err == nil {
+		indexed_projects[filepath.Join(usr_home, key)] = entry
+	}
+	return err
+}
+
+// every project in the index, most recently seen first
+func read_project_index(usr_home string) ([]projectEntry, error) {
+	var projects []projectEntry
+	if _, err := os.Stat(filepath.Join(usr_home, project_index_file)); os.IsNotExist(err) {
+		return projects, nil
+	}
+	err := with_project_index(usr_home, false, func(b *bolt.Bucket) error {
+		return b.ForEach(func(_ []byte, value []byte) error {
+			var project projectEntry
+			if err := json.Unmarshal(value, &project); err != nil {
+				return err
+			}
+			projects = append(projects, project)
+			return nil
+		})
+	})
+	sort.SliceStable(projects, func(i int, j int) bool { return projects[i].LastSeen > projects[j].LastSeen })
+	return projects, err
+}
+
+func with_project_index(usr_home string, writable bool, fn func(b *bolt.Bucket) error) error {
+	// reading only takes a shared lock, so bj instances can read the index together
+	path := filepath.Join(usr_home, project_index_file)
+	if _, err := os.Stat(path); !writable && os.IsNotExist(err) {
+		return nil
+	}
+	index, err := bolt.Open(path, 0644, &bolt.Options{Timeout: store_timeout, ReadOnly: !writable})
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	if !writable {
+		return index.View(func(tx *bolt.Tx) error {
+			if b := tx.Bucket(projects_bucket); b != nil {
+				return fn(b)
+			}
+			return nil
+		})
+	}
+	return index.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(projects_bucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// how a project is shown, naming the cache of jobs in no particular project
+func project_display_name(project string) string {
+	if project == "" {
+		return "(all jobs)"
+	}
+	return project
+}
+
+// bj projects
+func run_projects(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: bj projects")
+		return 1
+	}
+	projects, err := read_project_index(config_dir())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading project index: "+err.Error())
+		return 1
+	}
+	if len(projects) == 0 {
+		fmt.Println("No cached projects")
+		return 0
+	}
+
+	fmt.Printf("%-30s %-16s %6s %6s %6s %6s\n", "PROJECT", "LAST SEEN", "RUN", "PEND", "DONE", "EXIT")
+	for _, project := range projects {
+		fmt.Printf("%-30s %-16s %6d %6d %6d %6d\n", project_display_name(project.Name), time.Unix(project.LastSeen, 0).Format("2006-01-02 15:04"),
+			project.Counts["RUN"], project.Counts["PEND"], project.Counts["DONE"], project.Counts["EXIT"])
+	}
+	return 0
+}
+
+// count the user's current jobs by the project (-Jd) they were submitted with
+func run_bjobs_projects() (map[string]int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("bjobs", "-a", "-json", "-o", "jobid job_description")
+	cmd.Stderr = &stderr
+	bjobsJson, err := cmd.Output()
+	// bjobs exits with an error when there are no jobs, but still prints JSON
+	if err != nil && len(bjobsJson) == 0 {
+		return nil, fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parse_project_names(bjobsJson)
+}
+
+func parse_project_names(bjobsJson []byte) (map[string]int, error) {
+	var bjobsResponse struct {
+		Records []struct {
+			JOB_DESCRIPTION string
+		} `json:"RECORDS"`
+	}
+	if err := json.Unmarshal(bjobsJson, &bjobsResponse); err != nil {
+		return nil, err
+	}
+	projects := make(map[string]int)
+	for _, record := range bjobsResponse.Records {
+		if record.JOB_DESCRIPTION != "" {
+			projects[record.JOB_DESCRIPTION]++
+		}
+	}
+	return projects, nil
+}
+
+// projectChoice is a project that can be switched to, from the current
+// jobs, the project index or both
+type projectChoice struct {
+	name      string
+	jobs      int
+	last_seen int64
+}
+
+// every project to offer, starting with all jobs, then the projects with
+// current jobs by name and the rest by when they were last seen
+func project_choices(current map[string]int, cached []projectEntry) []projectChoice {
+	choices := []projectChoice{{name: "", jobs: -1}}
+	var active []projectChoice
+	last_seen := make(map[string]int64)
+	for _, project := range cached {
+		last_seen[project.Name] = project.LastSeen
+	}
+	for name, jobs := range current {
+		active = append(active, projectChoice{name: name, jobs: jobs, last_seen: last_seen[name]})
+	}
+	sort.Slice(active, func(i int, j int) bool { return active[i].name < active[j].name })
+	choices = append(choices, active...)
+
+	// the index is already ordered by when projects were last seen
+	for _, project := range cached {
+		if _, ok := current[project.Name]; !ok && project.Name != "" {
+			choices = append(choices, projectChoice{name: project.Name, last_seen: project.LastSeen})
+		}
+	}
+	return choices
+}
+
+func (choice projectChoice) line() string {
+	line := fmt.Sprintf("%-40s", project_display_name(choice.name))
+	if choice.jobs > 0 {
+		line += fmt.Sprintf(" %6d jobs", choice.jobs)
+	} else {
+		line += fmt.Sprintf(" %11s", "")
+	}
+	if choice.last_seen > 0 {
+		line += "   cached " + time.Unix(choice.last_seen, 0).Format("2006-01-02 15:04")
+	}
+	return line
+}
+
+// list the projects of the user's jobs and those already cached, calling
+// on_pick with the one chosen
+func open_project_picker(on_pick func(project string)) {
+	current, err := run_bjobs_projects()
+	cached, index_err := read_project_index(config_dir())
+	if err == nil {
+		err = index_err
+	}
+	choices := project_choices(current, cached)
+
+	var lines []string
+	for _, choice := range choices {
+		lines = append(lines, choice.line())
+	}
+	hint := "Switch [Enter]  Other project [n]  Cancel [Esc] "
+	if err != nil {
+		hint = "Error listing projects: " + err.Error() + "  " + hint
+	}
+
+	m := open_modal("Switch project", lines, hint, nil)
+	m.on_key = func(key string) bool {
+		switch key {
+		case "<Enter>":
+			on_pick(choices[m.selected].name)
+			return true
+		case "n":
+			prompt := open_prompt("Project: ", "", func(text string) {
+				text = strings.TrimSpace(text)
+				if err := check_project(text); err != nil {
+					async_statusline_message("Error in project pattern: "+err.Error(), 3)
+				} else if text != "" {
+					on_pick(text)
+				}
+			}, nil)
+			prompt.note = "a name, a glob like glob:batch_* or a /regexp/"
+			prompt.render()
+			return true
+		case "<Escape>", "q":
+			return true
+		}
+		return false
+	}
+	m.selectable = true
+	for i, choice := range choices {
+		if choice.name == proj_name {
+			m.selected = i
+		}
+	}
+	m.move_selection(0)
+	m.render()
+}
+
+// show the project being watched in the corner of the job table
+func set_project_label() {
+	if !projectBool {
+		project_name_label.Text = ""
+		return
+	}
+	// Truncate only the displayed text if too long
+	display_name := proj_name
+	proj_name_rune := []rune(proj_name)
+	if len(proj_name_rune) > 20 {
+		display_name = string(proj_name_rune[0:20]) + "..."
+	}
+	project_name_label.Text = display_name
+	project_name_label.TextStyle.Fg = ColorBlue
+	project_name_label.SetRect((termWidth - len([]rune(display_name)) - 2), termHeight-6, termWidth+1, termHeight-3)
+}
+
+// save the jobs being watched and load those of another project in their
+// place, returning the project's store and jobs
+func switch_project(usr_home string, usr_config string, db map[string]recStruct, project string) (string, map[string]recStruct) {
+	writeDatabase(usr_home, usr_config, db, resource_history)
+
+	proj_name = project
+	projectBool = project != ""
+	usr_config, err := prepare_project_store(proj_name)
+	if err != nil {
+		statusline.Text = "Error in migrating job cache: " + err.Error()
+		ui.Render(statusline_grid)
+	}
+	db = readSavedDatabase(usr_config)
+	resource_history = readSavedHistory(usr_config)
+
+	// marks, the selection and notifications belong to the previous project
+	if active_tab < len(project_tabs) {
+		project_tabs[active_tab].project = project
+	}
+	marked_jobids = make(map[string]bool)
+	selected_jobid = ""
+	table_offset = 0
+	email_on = false
+	set_project_label()
+
+	bjobs_map := run_bjobs()
+	db = updateDatabase(db, bjobs_map)
+	record_resource_samples(resource_history, bjobs_map, time.Now().Unix())
+	writeDatabase(usr_home, usr_config, db, resource_history)
+	return usr_config, db
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestEncodeProjectName(t *testing.T) {
+	tests := []struct {
+		project  string
+		expected string
+	}{
+		{"fqcomp", "fqcomp"},
+		{"fq compression", "fq%20compression"},
+		{"../../etc/passwd", "%2E.%2F..%2Fetc%2Fpasswd"},
+		{".hidden", "%2Ehidden"},
+		{"run_2.1-final", "run_2.1-final"},
+		{"100%", "100%25"},
+	}
+	for _, tt := range tests {
+		if got := encode_project_name(tt.project); got != tt.expected {
+			t.Errorf("encode_project_name(%q) = %q, expected %q", tt.project, got, tt.expected)
+		}
+	}
+
+	long := strings.Repeat("a", 300)
+	encoded := encode_project_name(long)
+	if len(encoded) != max_project_file_name {
+		t.Errorf("Expected a long name to be shortened to %d, got %d", max_project_file_name, len(encoded))
+	}
+	if encoded == encode_project_name(long+"b") {
+		t.Error("Expected long names differing at the end to be kept apart")
+	}
+}
+
+func TestProjectStorePath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if got := project_store_path(""); got != config_dir()+"history.db" {
+		t.Errorf("Expected jobs of no project in the config directory, got %s", got)
+	}
+	for _, project := range []string{"fq compression", "../../escape", "a/b", ".."} {
+		path := project_store_path(project)
+		if filepath.Dir(path) != filepath.Clean(config_dir()+"projects") {
+			t.Errorf("Expected the store of %q in the projects directory, got %s", project, path)
+		}
+	}
+	if _, ok := legacy_project_path("../../escape", "history.db"); ok {
+		t.Error("Expected a legacy path outside the config directory to be refused")
+	}
+}
+
+func TestPrepareProjectStoreMovesLegacyStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	os.MkdirAll(config_dir(), 0755)
+	old_store := config_dir() + "fq compressionhistory.db"
+	writeDatabase(config_dir(), old_store, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}}, nil)
+
+	path, err := prepare_project_store("fq compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != project_store_path("fq compression") {
+		t.Errorf("Expected the encoded store path, got %s", path)
+	}
+	if _, err := os.Stat(old_store); !os.IsNotExist(err) {
+		t.Error("Expected the legacy store to be moved")
+	}
+	jobs, err := readJobCache(path)
+	if err != nil || len(jobs) != 1 {
+		t.Errorf("Expected the moved store's job, got %v %v", jobs, err)
+	}
+}
+
+func TestProjectIndex(t *testing.T) {
+	home := t.TempDir()
+	projects, err := read_project_index(home)
+	if err != nil || len(projects) != 0 {
+		t.Fatalf("Expected no projects before any are seen, got %v %v", projects, err)
+	}
+
+	update_project_index(home, "fqcomp", map[string]recStruct{"1": {STAT: "RUN"}, "2": {STAT: "EXIT"}, "3": {STAT: "EXIT"}}, 100)
+	update_project_index(home, "", map[string]recStruct{"4": {STAT: "PEND"}}, 200)
+	update_project_index(home, "fqcomp", map[string]recStruct{"1": {STAT: "DONE"}}, 50)
+
+	projects, err = read_project_index(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || projects[0].Name != "" || projects[1].Name != "fqcomp" {
+		t.Fatalf("Expected both projects, most recently seen first, got %+v", projects)
+	}
+	if projects[1].Counts["DONE"] != 1 || projects[1].Counts["EXIT"] != 0 {
+		t.Errorf("Expected the counts of the last update, got %v", projects[1].Counts)
+	}
+}
+
+// Test that reading the index opens it read-only, so readers don't block
+// each other and nothing is created when no project has been seen
+func TestReadProjectIndexReadOnly(t *testing.T) {
+	home := t.TempDir()
+	if _, err := read_project_index(home); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, project_index_file)); !os.IsNotExist(err) {
+		t.Error("Expected reading to leave no index behind")
+	}
+
+	update_project_index(home, "fqcomp", map[string]recStruct{"1": {STAT: "RUN"}}, 100)
+	reader, err := bolt.Open(filepath.Join(home, project_index_file), 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if projects, err := read_project_index(home); err != nil || len(projects) != 1 {
+		t.Errorf("Expected to read the index alongside another reader, got %v %v", projects, err)
+	}
+}
+
+// Test that the index is only written again once a project's counts
+// change or its last seen time is out of date
+func TestProjectIndexSkipsUnchangedWrites(t *testing.T) {
+	home := t.TempDir()
+	db := map[string]recStruct{"1": {STAT: "RUN"}}
+	last_seen := func() int64 {
+		projects, err := read_project_index(home)
+		if err != nil || len(projects) != 1 {
+			t.Fatalf("Expected one project in the index, got %v %v", projects, err)
+		}
+		return projects[0].LastSeen
+	}
+
+	update_project_index(home, "fqcomp", db, 1000)
+	update_project_index(home, "fqcomp", db, 1010)
+	if seen := last_seen(); seen != 1000 {
+		t.Errorf("Expected an unchanged project not to be written again, got last seen %d", seen)
+	}
+	update_project_index(home, "fqcomp", db, 1000+project_index_interval)
+	if seen := last_seen(); seen != 1000+project_index_interval {
+		t.Errorf("Expected the last seen time to be written once out of date, got %d", seen)
+	}
+	update_project_index(home, "fqcomp", map[string]recStruct{"1": {STAT: "DONE"}}, 1000+project_index_interval+1)
+	if seen := last_seen(); seen != 1000+project_index_interval+1 {
+		t.Errorf("Expected changed counts to be written straight away, got %d", seen)
+	}
+}
+
+func TestRunProjects(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if got := run_projects(nil); got != 0 {
+		t.Errorf("run_projects with no index = %d, expected 0", got)
+	}
+	os.MkdirAll(config_dir(), 0755)
+	update_project_index(config_dir(), "fqcomp", map[string]recStruct{"1": {STAT: "RUN"}}, 100)
+	if got := run_projects(nil); got != 0 {
+		t.Errorf("run_projects = %d, expected 0", got)
+	}
+	if got := run_projects([]string{"extra"}); got != 1 {
+		t.Errorf("run_projects with arguments = %d, expected 1", got)
+	}
+}
+
+func TestParseProjectNames(t *testing.T) {
+	projects, err := parse_project_names([]byte(read_fixture(t, "test/data/jobs_projects.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || projects["fq compression"] != 3 || projects["alignment"] != 1 {
+		t.Errorf("Expected jobs counted by project, without jobs of no project, got %v", projects)
+	}
+	if _, err := parse_project_names([]byte("not json")); err == nil {
+		t.Error("Expected an error for output that isn't JSON")
+	}
+}
+
+func TestProjectChoices(t *testing.T) {
+	current := map[string]int{"fqcomp": 3, "align": 1}
+	cached := []projectEntry{{Name: "old", LastSeen: 300}, {Name: "", LastSeen: 250}, {Name: "fqcomp", LastSeen: 200}, {Name: "older", LastSeen: 100}}
+	choices := project_choices(current, cached)
+
+	var names []string
+	for _, choice := range choices {
+		names = append(names, choice.name)
+	}
+	if strings.Join(names, ",") != ",align,fqcomp,old,older" {
+		t.Errorf("Expected all jobs, current projects by name then cached by last seen, got %q", names)
+	}
+	if choices[2].jobs != 3 || choices[2].last_seen != 200 {
+		t.Errorf("Expected a current project's job count and when it was cached, got %+v", choices[2])
+	}
+	if !strings.HasPrefix(choices[0].line(), "(all jobs)") || !strings.Contains(choices[2].line(), "3 jobs") {
+		t.Errorf("Unexpected choice lines %q and %q", choices[0].line(), choices[2].line())
+	}
+}
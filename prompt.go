@@ -0,0 +1,86 @@
+package main
+
+import (
+	ui "github.com/gizak/termui/v3"
+)
+
+// textPrompt collects a single line of typed input on the statusline,
+// for searches and for actions that need a free-text argument
+type textPrompt struct {
+	label     string
+	text      string
+	on_submit func(text string)
+	on_cancel func()
+	// called after each edit, for input applied as it is typed
+	on_change func(text string)
+	// shown after the typed text, e.g. why the input isn't valid yet
+	note string
+}
+
+// the prompt currently receiving keyboard input, nil when none is open
+var active_prompt *textPrompt
+
+func open_prompt(label string, initial string, on_submit func(text string), on_cancel func()) *textPrompt {
+	active_prompt = &textPrompt{
+		label:     label,
+		text:      initial,
+		on_submit: on_submit,
+		on_cancel: on_cancel,
+	}
+	active_prompt.render()
+	return active_prompt
+}
+
+func (p *textPrompt) render() {
+	statusline.TextStyle.Fg = ColorYellow
+	statusline.Text = p.label + p.text + "_"
+	if p.note != "" {
+		statusline.Text += "   (" + p.note + ")"
+	}
+	ui.Render(statusline_grid)
+}
+
+// apply a key press to the typed text, ignoring keys that don't edit it
+func edit_text(text string, key string) string {
+	switch key {
+	case "<Space>":
+		return text + " "
+	case "<Backspace>", "<C-<Backspace>>":
+		text_rune := []rune(text)
+		if len(text_rune) > 0 {
+			return string(text_rune[:len(text_rune)-1])
+		}
+		return text
+	case "<C-u>":
+		return ""
+	}
+
+	// named keys like <Up> or <C-d> are ignored, only single characters are typed
+	if len([]rune(key)) == 1 {
+		return text + key
+	}
+	return text
+}
+
+func handle_prompt_event(e ui.Event) {
+	p := active_prompt
+	switch e.ID {
+	case "<Enter>":
+		active_prompt = nil
+		statusline.TextStyle.Fg = ColorGrey
+		p.on_submit(p.text)
+	case "<Escape>", "<C-c>":
+		active_prompt = nil
+		statusline.TextStyle.Fg = ColorGrey
+		statusline.Text = ""
+		if p.on_cancel != nil {
+			p.on_cancel()
+		}
+	default:
+		p.text = edit_text(p.text, e.ID)
+		if p.on_change != nil {
+			p.on_change(p.text)
+		}
+		p.render()
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// Test that key presses edit the typed text
+func TestEditText(t *testing.T) {
+	text := ""
+	for _, key := range []string{"s", "t", "a", "t", ":", "<Space>", "E"} {
+		text = edit_text(text, key)
+	}
+	if text != "stat: E" {
+		t.Errorf("Expected typed text 'stat: E', got %q", text)
+	}
+
+	text = edit_text(text, "<Backspace>")
+	if text != "stat: " {
+		t.Errorf("Expected backspace to remove last character, got %q", text)
+	}
+
+	// named keys don't type anything
+	text = edit_text(text, "<Up>")
+	if text != "stat: " {
+		t.Errorf("Expected named keys to be ignored, got %q", text)
+	}
+
+	if edit_text(text, "<C-u>") != "" {
+		t.Error("Expected <C-u> to clear the text")
+	}
+}
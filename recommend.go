@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// recommendations cover this percentile of completed jobs, with headroom
+// added on top so the next run doesn't sit right at its limits
+const recommend_percentile = 95.0
+const recommend_headroom = 1.2
+
+// runs of digits in job names, which usually number samples or chunks
+var job_name_number_regex = regexp.MustCompile(`\d+`)
+
+// jobGroup is the completed jobs sharing a job name pattern
+type jobGroup struct {
+	pattern  string
+	done     []recStruct
+	memlimit int // jobs killed by TERM_MEMLIMIT
+	runlimit int // jobs killed by TERM_RUNLIMIT
+}
+
+// resourceRecommendation is the bsub options suggested for a job group
+type resourceRecommendation struct {
+	mem_mb   int // for -M and -R rusage[mem=]
+	minutes  int // for -W
+	cores    int // for -n
+	mem_p    float64
+	run_p    float64
+	cores_p  float64
+	has_mem  bool
+	has_time bool
+}
+
+// the pattern a job name is grouped under, with numbers and array
+// indexes replaced so e.g. "align_12[3]" and "align_7[1]" group together
+func job_name_pattern(name string) string {
+	if open := strings.Index(name, "["); open != -1 && strings.HasSuffix(name, "]") {
+		name = name[:open]
+	}
+	if name == "" {
+		return "(unnamed)"
+	}
+	return job_name_number_regex.ReplaceAllString(name, "*")
+}
+
+// group finished jobs by name pattern, largest groups first
+func group_jobs_by_name(db map[string]recStruct) []*jobGroup {
+	groups := make(map[string]*jobGroup)
+	for _, job := range db {
+		if job.STAT != "DONE" && job.STAT != "EXIT" {
+			continue
+		}
+		pattern := job_name_pattern(job.JOB_NAME)
+		group, ok := groups[pattern]
+		if !ok {
+			group = &jobGroup{pattern: pattern}
+			groups[pattern] = group
+		}
+		switch {
+		case job.STAT == "DONE":
+			group.done = append(group.done, job)
+		case strings.Contains(job.EXIT_REASON, "TERM_MEMLIMIT"):
+			group.memlimit++
+		case strings.Contains(job.EXIT_REASON, "TERM_RUNLIMIT"):
+			group.runlimit++
+		}
+	}
+
+	var sorted []*jobGroup
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i int, j int) bool {
+		if len(sorted[i].done) != len(sorted[j].done) {
+			return len(sorted[i].done) > len(sorted[j].done)
+		}
+		return sorted[i].pattern < sorted[j].pattern
+	})
+	return sorted
+}
+
+// the nearest-rank percentile of the values, 0 when there are none
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func recommend_resources(jobs []recStruct) resourceRecommendation {
+	var mems, run_times, cores []float64
+	for _, job := range jobs {
+		if job.MAX_MEM != "" {
+			mems = append(mems, parse_human_sizes(parse_bytes_output(job.MAX_MEM)))
+		}
+		if run_time := job.run_time_seconds(); run_time > 0 {
+			run_times = append(run_times, run_time)
+			if job.CPU_USED != "" {
+				cores = append(cores, job.cpu_seconds()/run_time)
+			}
+		}
+	}
+
+	rec := resourceRecommendation{cores: 1, has_mem: len(mems) > 0, has_time: len(run_times) > 0}
+	rec.mem_p = percentile(mems, recommend_percentile)
+	rec.run_p = percentile(run_times, recommend_percentile)
+	rec.cores_p = percentile(cores, recommend_percentile)
+
+	// round memory up to the next 100MB and time to the next 5 minutes
+	rec.mem_mb = int(math.Ceil(rec.mem_p*recommend_headroom/1e6/100)) * 100
+	rec.minutes = int(math.Ceil(rec.run_p*recommend_headroom/60/5)) * 5
+	if cores := int(math.Ceil(rec.cores_p)); cores > 1 {
+		rec.cores = cores
+	}
+	return rec
+}
+
+// the bsub options for a recommendation, leaving out those without data
+func (rec resourceRecommendation) bsub_options() string {
+	var options []string
+	if rec.has_mem && rec.mem_mb > 0 {
+		options = append(options, fmt.Sprintf(`-M %d -R "rusage[mem=%d]"`, rec.mem_mb, rec.mem_mb))
+	}
+	if rec.has_time && rec.minutes > 0 {
+		options = append(options, fmt.Sprintf("-W %d:%02d", rec.minutes/60, rec.minutes%60))
+	}
+	options = append(options, fmt.Sprintf("-n %d", rec.cores))
+	return strings.Join(options, " ")
+}
+
+func recommendation_lines(db map[string]recStruct) []string {
+	groups := group_jobs_by_name(db)
+	if len(groups) == 0 {
+		return []string{"No finished jobs to recommend resources from"}
+	}
+
+	var lines []string
+	for i, group := range groups {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		heading := fmt.Sprintf("%s (%d done", group.pattern, len(group.done))
+		if group.memlimit > 0 {
+			heading += fmt.Sprintf(", %d hit TERM_MEMLIMIT", group.memlimit)
+		}
+		if group.runlimit > 0 {
+			heading += fmt.Sprintf(", %d hit TERM_RUNLIMIT", group.runlimit)
+		}
+		lines = append(lines, heading+")")
+
+		if len(group.done) == 0 {
+			lines = append(lines, "  no completed jobs to size from")
+		} else {
+			rec := recommend_resources(group.done)
+			lines = append(lines, "  bsub "+rec.bsub_options())
+			lines = append(lines, fmt.Sprintf("  p%.0f of peak memory %s, run time %s, cores used %.1f, plus %.0f%% headroom",
+				recommend_percentile, format_bytes(rec.mem_p), format_duration(int(rec.run_p)), rec.cores_p, (recommend_headroom-1)*100))
+		}
+
+		// jobs killed at a limit needed more than they had, which their peak doesn't show
+		if group.memlimit > 0 {
+			lines = append(lines, "  note: jobs killed by TERM_MEMLIMIT needed more memory than they were given, so allow more than suggested")
+		}
+		if group.runlimit > 0 {
+			lines = append(lines, "  note: jobs killed by TERM_RUNLIMIT needed longer than they were given, so allow more than suggested")
+		}
+	}
+	return lines
+}
+
+// bj recommend [project]
+func run_recommend(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: bj recommend [project]")
+		return 1
+	}
+	project := ""
+	if len(args) == 1 {
+		project = args[0]
+	}
+
+	db, err := load_project_jobs(project)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error in reading job cache: "+err.Error())
+		return 1
+	}
+	for _, line := range recommendation_lines(db) {
+		fmt.Println(line)
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJobNamePattern(t *testing.T) {
+	tests := map[string]string{
+		"align_sample12":  "align_sample*",
+		"align_sample7":   "align_sample*",
+		"chunk_3_of_10":   "chunk_*_of_*",
+		"variant_call[4]": "variant_call",
+		"":                "(unnamed)",
+	}
+	for name, expected := range tests {
+		if got := job_name_pattern(name); got != expected {
+			t.Errorf("job_name_pattern(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10}
+	if got := percentile(values, 95); got != 10 {
+		t.Errorf("Expected p95 of 10, got %v", got)
+	}
+	if got := percentile(values, 50); got != 5 {
+		t.Errorf("Expected p50 of 5, got %v", got)
+	}
+	if got := percentile(nil, 95); got != 0 {
+		t.Errorf("Expected 0 for no values, got %v", got)
+	}
+	if values[0] != 5 {
+		t.Error("Expected the values to be left unsorted")
+	}
+}
+
+func recommend_db() map[string]recStruct {
+	return map[string]recStruct{
+		"1": {JOBID: "1", STAT: "DONE", JOB_NAME: "align_1", MAX_MEM: "2 Gbytes", RUN_TIME: "3000 second(s)", CPU_USED: "9000 second(s)"},
+		"2": {JOBID: "2", STAT: "DONE", JOB_NAME: "align_2", MAX_MEM: "3 Gbytes", RUN_TIME: "6000 second(s)", CPU_USED: "15000 second(s)"},
+		"3": {JOBID: "3", STAT: "EXIT", JOB_NAME: "align_3", EXIT_REASON: "TERM_MEMLIMIT: job killed after reaching LSF memory usage limit"},
+		"4": {JOBID: "4", STAT: "EXIT", JOB_NAME: "merge", EXIT_REASON: "TERM_RUNLIMIT: job killed after reaching LSF run time limit"},
+		"5": {JOBID: "5", STAT: "RUN", JOB_NAME: "align_4", MAX_MEM: "9 Gbytes"},
+	}
+}
+
+func TestGroupJobsByName(t *testing.T) {
+	groups := group_jobs_by_name(recommend_db())
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	align := groups[0]
+	if align.pattern != "align_*" || len(align.done) != 2 || align.memlimit != 1 {
+		t.Errorf("Unexpected align group %+v", align)
+	}
+	if merge := groups[1]; merge.pattern != "merge" || len(merge.done) != 0 || merge.runlimit != 1 {
+		t.Errorf("Unexpected merge group %+v", merge)
+	}
+}
+
+func TestRecommendResources(t *testing.T) {
+	groups := group_jobs_by_name(recommend_db())
+	rec := recommend_resources(groups[0].done)
+
+	// p95 of 3G with 20% headroom is 3.6G, p95 of 100 minutes with headroom is 120,
+	// and the jobs used at most 3 cores
+	if rec.mem_mb != 3600 || rec.minutes != 120 || rec.cores != 3 {
+		t.Errorf("Unexpected recommendation %+v", rec)
+	}
+	if got, expected := rec.bsub_options(), `-M 3600 -R "rusage[mem=3600]" -W 2:00 -n 3`; got != expected {
+		t.Errorf("Got options %q, expected %q", got, expected)
+	}
+
+	// without usage data only the core count is suggested
+	if got := recommend_resources([]recStruct{{STAT: "DONE"}}).bsub_options(); got != "-n 1" {
+		t.Errorf("Expected only -n 1 without data, got %q", got)
+	}
+}
+
+func TestRecommendationLines(t *testing.T) {
+	report := strings.Join(recommendation_lines(recommend_db()), "\n")
+	for _, expected := range []string{
+		"align_* (2 done, 1 hit TERM_MEMLIMIT)",
+		`bsub -M 3600 -R "rusage[mem=3600]" -W 2:00 -n 3`,
+		"merge (0 done, 1 hit TERM_RUNLIMIT)",
+		"no completed jobs to size from",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected %q in the recommendations:\n%s", expected, report)
+		}
+	}
+
+	if lines := recommendation_lines(map[string]recStruct{}); lines[0] != "No finished jobs to recommend resources from" {
+		t.Errorf("Unexpected recommendations for no jobs %v", lines)
+	}
+}
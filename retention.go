@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// retentionPolicy limits how long and how many finished jobs are kept in
+// a project's store, a limit of 0 keeping them forever
+type retentionPolicy struct {
+	done_days    int
+	exit_days    int
+	max_finished int
+}
+
+func retention_policy() retentionPolicy {
+	return retentionPolicy{
+		done_days:    config.DoneRetentionDays,
+		exit_days:    config.ExitRetentionDays,
+		max_finished: config.MaxFinishedJobs,
+	}
+}
+
+// the finished jobs the policy no longer keeps, given in the order they
+// finished. Jobs past their age limit go first, then the oldest DONE jobs
+// and only then the oldest EXIT jobs until the count is within the limit,
+// as exited jobs are usually the ones still worth looking into
+func expired_jobs(finished []finishedJob, policy retentionPolicy, now int64) []string {
+	var expired []string
+	var kept []finishedJob
+	for _, job := range finished {
+		days := policy.done_days
+		if job.stat == "EXIT" {
+			days = policy.exit_days
+		}
+		if days > 0 && now-job.finished > int64(days)*86400 {
+			expired = append(expired, job.id)
+		} else {
+			kept = append(kept, job)
+		}
+	}
+
+	if policy.max_finished <= 0 || len(kept) <= policy.max_finished {
+		return expired
+	}
+	sort.SliceStable(kept, func(i int, j int) bool { return kept[i].stat == "DONE" && kept[j].stat != "DONE" })
+	for _, job := range kept[:len(kept)-policy.max_finished] {
+		expired = append(expired, job.id)
+	}
+	return expired
+}
+
+// finished jobs the retention limits removed while bj has been running.
+// bjobs -a goes on listing jobs for a while after they finish, so these are
+// left out of what it reports rather than being added back as new jobs
+var pruned_jobids = make(map[string]bool)
+var pruned_jobids_lock sync.Mutex
+
+// remove the finished jobs the policy no longer keeps, returning their IDs
+func prune_store(tx *bolt.Tx, policy retentionPolicy, now int64) ([]string, error) {
+	expired := expired_jobs(finished_jobs(tx), policy, now)
+	if err := delete_jobs(tx, expired); err != nil {
+		return nil, err
+	}
+	pruned_jobids_lock.Lock()
+	defer pruned_jobids_lock.Unlock()
+	for _, id := range expired {
+		pruned_jobids[id] = true
+	}
+	return expired, nil
+}
+
+// leave the jobs already pruned out of what bjobs reports
+func drop_pruned_jobs(bjobs_map map[string]recStruct) map[string]recStruct {
+	pruned_jobids_lock.Lock()
+	defer pruned_jobids_lock.Unlock()
+	for id := range bjobs_map {
+		if pruned_jobids[id] {
+			delete(bjobs_map, id)
+		}
+	}
+	return bjobs_map
+}
+
+// drop removed jobs from what's held in memory too, so they aren't
+// written back to the store
+func forget_jobs(db map[string]recStruct, ids []string) {
+	for _, id := range ids {
+		delete(db, id)
+		delete(resource_history, id)
+		delete(marked_jobids, id)
+	}
+}
+
+// move the cached finished jobs that are DONE, when done_only is set, or
+// finished more than older_than_days ago into the archive, returning how many went
+func clear_finished_jobs(usr_config string, db map[string]recStruct, done_only bool, older_than_days int) (int, error) {
+	var removed []string
+	err := with_store(usr_config, false, func(tx *bolt.Tx) error {
+		// every DONE job is in the state index, without reading the others
+		if done_only && older_than_days == 0 {
+			removed = jobs_in_state(tx, "DONE")
+			return nil
+		}
+		cutoff := time.Now().Unix() - int64(older_than_days)*86400
+		for _, job := range finished_jobs(tx) {
+			if done_only && job.stat != "DONE" {
+				continue
+			}
+			if older_than_days > 0 && job.finished > cutoff {
+				continue
+			}
+			removed = append(removed, job.id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := archive_jobs(usr_config, removed); err != nil {
+		return 0, err
+	}
+	forget_jobs(db, removed)
+	return len(removed), nil
+}
+
+// ask what to clear from the cache, running clear_all for everything
+func open_clear_menu(usr_config string, db map[string]recStruct, clear_all func()) {
+	lines := []string{
+		"[a](fg:yellow)  Every job, archiving the whole cache",
+		"[d](fg:yellow)  DONE jobs only",
+		"[o](fg:yellow)  Finished jobs older than a number of days",
+		"[u](fg:yellow)  Undo the last clear",
+		"",
+		"Cleared jobs are kept in the archive, see bj archive list",
+	}
+	report := func(count int, err error) {
+		if err != nil {
+			async_statusline_message("Error clearing cache: "+err.Error(), 5)
+			return
+		}
+		async_statusline_message("Cleared "+strconv.Itoa(count)+" cached jobs, undo with [c] then [u]", 3)
+	}
+
+	open_modal("Clear cached jobs", lines, "Choose [a d o u]  Cancel [Esc] ", func(key string) bool {
+		switch key {
+		case "a":
+			clear_all()
+			return true
+		case "d":
+			report(clear_finished_jobs(usr_config, db, true, 0))
+			return true
+		case "o":
+			prompt := open_prompt("Clear jobs finished more than this many days ago: ", "30", func(text string) {
+				days, err := strconv.Atoi(text)
+				if err != nil || days < 1 {
+					async_statusline_message("Error: give a whole number of days", 2)
+					return
+				}
+				report(clear_finished_jobs(usr_config, db, false, days))
+			}, nil)
+			prompt.note = "finished jobs older than this are removed"
+			prompt.render()
+			return true
+		case "u":
+			jobs, samples, err := restore_last_archive(usr_config)
+			if err != nil {
+				async_statusline_message("Error undoing clear: "+err.Error(), 5)
+				return true
+			}
+			// only add back what isn't shown already, which bjobs has more recent records of
+			for id, job := range jobs {
+				if _, ok := db[id]; !ok {
+					db[id] = job
+				}
+			}
+			for id, job_samples := range samples {
+				if _, ok := resource_history[id]; !ok {
+					resource_history[id] = job_samples
+				}
+			}
+			async_statusline_message("Restored "+strconv.Itoa(len(jobs))+" cleared jobs", 2)
+			return true
+		case "q", "<Escape>":
+			return true
+		}
+		return false
+	})
+}
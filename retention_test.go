@@ -0,0 +1,213 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const day = int64(86400)
+
+func TestExpiredJobsByAge(t *testing.T) {
+	now := 100 * day
+	finished := []finishedJob{
+		{"1", "DONE", now - 40*day},
+		{"2", "EXIT", now - 40*day},
+		{"3", "EXIT", now - 100*day},
+		{"4", "DONE", now - 1*day},
+	}
+	policy := retentionPolicy{done_days: 30, exit_days: 90}
+	if got := expired_jobs(finished, policy, now); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("Expected jobs 1 and 3 to expire, got %v", got)
+	}
+
+	if got := expired_jobs(finished, retentionPolicy{}, now); len(got) != 0 {
+		t.Errorf("Expected nothing to expire without limits, got %v", got)
+	}
+}
+
+func TestExpiredJobsByCount(t *testing.T) {
+	finished := []finishedJob{
+		{"1", "EXIT", 10},
+		{"2", "DONE", 20},
+		{"3", "EXIT", 30},
+		{"4", "DONE", 40},
+		{"5", "DONE", 50},
+	}
+
+	// the oldest DONE jobs go before any EXIT job
+	if got := expired_jobs(finished, retentionPolicy{max_finished: 3}, 100); !reflect.DeepEqual(got, []string{"2", "4"}) {
+		t.Errorf("Expected jobs 2 and 4 to expire, got %v", got)
+	}
+	// and the oldest EXIT jobs once there are no DONE jobs left to drop
+	if got := expired_jobs(finished, retentionPolicy{max_finished: 1}, 100); !reflect.DeepEqual(got, []string{"2", "4", "5", "1"}) {
+		t.Errorf("Expected jobs 2, 4, 5 and 1 to expire, got %v", got)
+	}
+}
+
+func retention_store(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "history.db")
+	now := time.Now().Unix()
+	steps := []struct {
+		now  int64
+		jobs map[string]recStruct
+	}{
+		{now - 60*day, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}, "2": {JOBID: "2", STAT: "EXIT"}}},
+		{now - 1*day, map[string]recStruct{"3": {JOBID: "3", STAT: "DONE"}}},
+		{now, map[string]recStruct{"4": {JOBID: "4", STAT: "RUN"}}},
+	}
+	for _, step := range steps {
+		err := with_store(path, true, func(tx *bolt.Tx) error { return store_jobs(tx, step.jobs, step.now) })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		return store_samples(tx, map[string][]resourceSample{"1": {{Time: 1}}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func stored_ids(t *testing.T, path string) []string {
+	db, err := readJobCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id := range db {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestPruneStore(t *testing.T) {
+	path := retention_store(t)
+	var expired []string
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		var err error
+		expired, err = prune_store(tx, retentionPolicy{done_days: 30, exit_days: 90}, time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expired, []string{"1"}) {
+		t.Errorf("Expected only job 1 to expire, got %v", expired)
+	}
+	if ids := stored_ids(t, path); !reflect.DeepEqual(ids, []string{"2", "3", "4"}) {
+		t.Errorf("Expected jobs 2, 3 and 4 to be kept, got %v", ids)
+	}
+
+	with_store(path, false, func(tx *bolt.Tx) error {
+		if tx.Bucket(samples_bucket).Bucket([]byte("1")) != nil {
+			t.Error("Expected the expired job's samples to be removed")
+		}
+		if ids := jobs_in_state(tx, "DONE"); !reflect.DeepEqual(ids, []string{"3"}) {
+			t.Errorf("Expected only job 3 left DONE, got %v", ids)
+		}
+		if finished := finished_jobs(tx); len(finished) != 2 {
+			t.Errorf("Expected 2 finished jobs left, got %v", finished)
+		}
+		return nil
+	})
+}
+
+// Test that pruning at the default settings deletes nothing, as finished
+// jobs are only dropped once the user sets a limit
+func TestPruneStoreKeepsEverythingByDefault(t *testing.T) {
+	defer func() { config = default_config() }()
+	config = default_config()
+
+	path := retention_store(t)
+	before := stored_ids(t, path)
+	var expired []string
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		var err error
+		expired, err = prune_store(tx, retention_policy(), time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("Expected no jobs to expire by default, got %v", expired)
+	}
+	if ids := stored_ids(t, path); !reflect.DeepEqual(ids, before) {
+		t.Errorf("Expected every job to be kept, had %v and now %v", before, ids)
+	}
+}
+
+// Test that a pruned job bjobs -a still lists isn't added back to the store
+func TestPrunedJobsNotReadded(t *testing.T) {
+	defer func() { pruned_jobids = make(map[string]bool) }()
+
+	path := retention_store(t)
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		_, err := prune_store(tx, retentionPolicy{done_days: 30, exit_days: 90}, time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := readJobCache(path)
+	bjobs_map := drop_pruned_jobs(map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}, "5": {JOBID: "5", STAT: "RUN"}})
+	writeDatabase(filepath.Dir(path), path, updateDatabase(db, bjobs_map), nil)
+	if ids := stored_ids(t, path); !reflect.DeepEqual(ids, []string{"2", "3", "4", "5"}) {
+		t.Errorf("Expected the pruned job to stay out of the store, got %v", ids)
+	}
+}
+
+func TestClearFinishedJobs(t *testing.T) {
+	path := retention_store(t)
+	db, _ := readJobCache(path)
+
+	count, err := clear_finished_jobs(path, db, true, 0)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 DONE jobs cleared, got %d %v", count, err)
+	}
+	if ids := stored_ids(t, path); !reflect.DeepEqual(ids, []string{"2", "4"}) {
+		t.Errorf("Expected jobs 2 and 4 left, got %v", ids)
+	}
+	if _, ok := db["1"]; ok {
+		t.Error("Expected cleared jobs to be removed from memory too")
+	}
+
+	count, err = clear_finished_jobs(path, db, false, 30)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 job finished over 30 days ago cleared, got %d %v", count, err)
+	}
+	if ids := stored_ids(t, path); !reflect.DeepEqual(ids, []string{"4"}) {
+		t.Errorf("Expected only the running job left, got %v", ids)
+	}
+}
+
+func TestFinishTimesIndexedForOlderStores(t *testing.T) {
+	path := retention_store(t)
+
+	// drop the index and version as a store made before they existed wouldn't have them
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(meta_bucket); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(finished_bucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with_store(path, false, func(tx *bolt.Tx) error {
+		if finished := finished_jobs(tx); len(finished) != 3 {
+			t.Errorf("Expected the 3 finished jobs indexed from their events, got %v", finished)
+		}
+		return nil
+	})
+}
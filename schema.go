@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// the version of bj, set when building releases with
+// -ldflags "-X main.bj_version=0.9"
+var bj_version = "dev"
+
+// the layout of the store this version of bj reads and writes, raised
+// whenever a change needs existing stores migrating
+const store_schema_version = 2
+
+// holds the storeMeta of the store under meta_key
+var meta_bucket = []byte("meta")
+var meta_key = []byte("meta")
+
+// storeMeta records which version of the layout a store uses, alongside
+// who wrote it and when
+type storeMeta struct {
+	SchemaVersion int    `json:"schema_version"`
+	BjVersion     string `json:"bj_version"` // the bj that last wrote to the store
+	Project       string `json:"project"`
+	Created       int64  `json:"created"`
+	Updated       int64  `json:"updated"`
+}
+
+// the migrations bringing a store up to date, store_migrations[v-1]
+// upgrading a store from version v to v+1
+var store_migrations = []func(tx *bolt.Tx) error{
+	// 1 to 2: index when each finished job finished
+	index_finish_times,
+}
+
+func read_store_meta(tx *bolt.Tx) (storeMeta, bool, error) {
+	var meta storeMeta
+	meta_b := tx.Bucket(meta_bucket)
+	if meta_b == nil {
+		return meta, false, nil
+	}
+	value := meta_b.Get(meta_key)
+	if value == nil {
+		return meta, false, nil
+	}
+	return meta, true, json.Unmarshal(value, &meta)
+}
+
+func write_store_meta(tx *bolt.Tx, meta storeMeta) error {
+	meta_b, err := tx.CreateBucketIfNotExists(meta_bucket)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return meta_b.Put(meta_key, value)
+}
+
+// create a new store's buckets, or migrate an older store to the current
+// layout. Stores from a newer bj are left untouched, as writing to them
+// could lose what the newer version records
+func prepare_store(tx *bolt.Tx, now int64) error {
+	meta, versioned, err := read_store_meta(tx)
+	if err != nil {
+		return err
+	}
+	if !versioned {
+		meta = storeMeta{SchemaVersion: store_schema_version, Created: now}
+		// stores from before versioning already have their jobs bucket
+		if tx.Bucket(jobs_bucket) != nil {
+			meta.SchemaVersion = 1
+		}
+	}
+	if meta.SchemaVersion > store_schema_version {
+		return fmt.Errorf("the cache was written by a newer version of bj (schema %d, this bj reads up to %d), update bj to use it", meta.SchemaVersion, store_schema_version)
+	}
+
+	for _, name := range [][]byte{jobs_bucket, state_bucket, events_bucket, samples_bucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+	if !versioned && meta.SchemaVersion == store_schema_version {
+		// a new store needs no migrating, only the buckets later versions added
+		if _, err := tx.CreateBucketIfNotExists(finished_bucket); err != nil {
+			return err
+		}
+	}
+	for meta.SchemaVersion < store_schema_version {
+		if err := store_migrations[meta.SchemaVersion-1](tx); err != nil {
+			return fmt.Errorf("migrating the cache from schema %d: %v", meta.SchemaVersion, err)
+		}
+		meta.SchemaVersion++
+	}
+
+	if versioned && meta.SchemaVersion == store_schema_version {
+		return nil
+	}
+	if meta.Created == 0 {
+		meta.Created = now
+	}
+	return write_store_meta(tx, meta)
+}
+
+// whether prepare_store has anything to do, so that stores already up to
+// date can be opened without taking the lock for writing
+func store_needs_preparing(tx *bolt.Tx) (bool, error) {
+	meta, versioned, err := read_store_meta(tx)
+	if err != nil || !versioned || meta.SchemaVersion != store_schema_version {
+		return true, err
+	}
+	for _, name := range [][]byte{jobs_bucket, state_bucket, events_bucket, samples_bucket, finished_bucket} {
+		if tx.Bucket(name) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// record that this bj has just written to the store for the project
+func touch_store_meta(tx *bolt.Tx, project string, now int64) error {
+	meta, _, err := read_store_meta(tx)
+	if err != nil {
+		return err
+	}
+	meta.SchemaVersion = store_schema_version
+	meta.BjVersion = bj_version
+	meta.Project = project
+	meta.Updated = now
+	if meta.Created == 0 {
+		meta.Created = now
+	}
+	return write_store_meta(tx, meta)
+}
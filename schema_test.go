@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func copy_fixture(t *testing.T, fixture string, path string) {
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stored_meta(t *testing.T, path string) storeMeta {
+	var meta storeMeta
+	err := with_store(path, false, func(tx *bolt.Tx) error {
+		var err error
+		meta, _, err = read_store_meta(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestMigrateUnversionedFixtures(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+	legacy_cache := filepath.Join(dir, "savedDatabase.json")
+	legacy_history := filepath.Join(dir, "savedHistory.json")
+	copy_fixture(t, "test/data/savedDatabase_unversioned.json", legacy_cache)
+	copy_fixture(t, "test/data/savedHistory_unversioned.json", legacy_history)
+
+	if err := migrate_json_cache("fq compression", path, legacy_cache, legacy_history); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := readJobCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db) != 3 {
+		t.Fatalf("Expected 3 jobs migrated, got %d", len(db))
+	}
+	// every field of the unversioned format survives
+	expected := recStruct{JOBID: "81077", STAT: "EXIT", QUEUE: "normal", EXIT_REASON: "TERM_MEMLIMIT: job killed after reaching LSF memory usage limit",
+		COMPLETE: "12.50% L", RUN_TIME: "900 second(s)", MAX_MEM: "4 Gbytes", MEMLIMIT: "4 G", NTHREADS: "1", EXIT_CODE: "130"}
+	if db["81077"] != expected {
+		t.Errorf("Job migrated as %+v, expected %+v", db["81077"], expected)
+	}
+
+	meta := stored_meta(t, path)
+	if meta.SchemaVersion != store_schema_version || meta.Project != "fq compression" || meta.BjVersion != bj_version {
+		t.Errorf("Unexpected metadata after migration %+v", meta)
+	}
+	if meta.Created == 0 || meta.Updated < meta.Created {
+		t.Errorf("Expected created and updated times, got %+v", meta)
+	}
+
+	var history map[string][]resourceSample
+	with_store(path, false, func(tx *bolt.Tx) error {
+		history, err = load_samples(tx)
+		return err
+	})
+	if samples := history["81061"]; len(samples) != 2 || samples[0].Time != 1700000000 {
+		t.Errorf("Expected both samples migrated in time order, got %v", samples)
+	}
+
+	// jobs that had finished are indexed for retention
+	with_store(path, false, func(tx *bolt.Tx) error {
+		if finished := finished_jobs(tx); len(finished) != 2 {
+			t.Errorf("Expected the 2 finished jobs indexed, got %v", finished)
+		}
+		return nil
+	})
+}
+
+func TestNewStoreIsVersioned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	writeDatabase(filepath.Dir(path), path, map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}}, nil)
+
+	meta := stored_meta(t, path)
+	if meta.SchemaVersion != store_schema_version || meta.Created == 0 || meta.Updated == 0 {
+		t.Errorf("Unexpected metadata for a new store %+v", meta)
+	}
+}
+
+func TestSchemaOneStoreIsMigrated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	writeDatabase(filepath.Dir(path), path, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}}, nil)
+
+	// take the store back to how the first store layout was, without a
+	// version or finish time index
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(meta_bucket); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(finished_bucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta := stored_meta(t, path); meta.SchemaVersion != store_schema_version {
+		t.Errorf("Expected the store migrated to schema %d, got %+v", store_schema_version, meta)
+	}
+	with_store(path, false, func(tx *bolt.Tx) error {
+		if finished := finished_jobs(tx); len(finished) != 1 {
+			t.Errorf("Expected the finished job indexed by the migration, got %v", finished)
+		}
+		return nil
+	})
+}
+
+func TestNewerStoreIsLeftAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	writeDatabase(filepath.Dir(path), path, map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}}, nil)
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		return write_store_meta(tx, storeMeta{SchemaVersion: store_schema_version + 1, BjVersion: "future"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readJobCache(path); err == nil {
+		t.Error("Expected an error reading a store from a newer bj")
+	}
+	if err := with_store(path, true, func(tx *bolt.Tx) error { return nil }); err == nil {
+		t.Error("Expected an error writing to a store from a newer bj")
+	}
+}
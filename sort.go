@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortColumn is a way of ordering the job table
+type sortColumn struct {
+	name string
+	// the values a job is ordered by, compared as numbers then as text,
+	// with NaN for a job that has no value to sort by
+	key func(job recStruct) (float64, string)
+}
+
+var sort_columns = []sortColumn{
+	{"status", func(job recStruct) (float64, string) { return float64(status_rank(job)), "" }},
+	{"job ID", func(job recStruct) (float64, string) { return 0, "" }},
+	{"memory", func(job recStruct) (float64, string) {
+		if mem_percent, ok := job.mem_percent(); ok {
+			return mem_percent, ""
+		}
+		return math.NaN(), ""
+	}},
+	{"%complete", func(job recStruct) (float64, string) { return job.complete_percent(), "" }},
+	{"run time", func(job recStruct) (float64, string) { return job.run_time_seconds(), "" }},
+	{"queue", func(job recStruct) (float64, string) { return 0, job.QUEUE }},
+	{"exit reason", func(job recStruct) (float64, string) { return 0, job.EXIT_REASON }},
+}
+
+// sortEntry holds the values a job is ordered by, worked out once per sort
+// rather than on every comparison so large tables sort quickly
+type sortEntry struct {
+	id     string
+	id_num int
+	alert  bool
+	// the job's project when jobs of several projects are grouped together
+	group string
+	// the job has no value for the sort column, so sorts after those that
+	// do in either direction
+	missing bool
+	num     float64
+	text    string
+}
+
+// the column the table is sorted by, its direction, and whether jobs
+// nearing their limits are kept at the top regardless of the sort
+var sort_index int
+var sort_descending bool
+var pin_alerts = true
+
+// position of a job's status in the default table order
+func status_rank(job recStruct) int {
+	switch job.STAT {
+	case "RUN":
+		return 0
+	case "USUSP", "SSUSP", "PSUSP":
+		return 1
+	case "EXIT":
+		return 2
+	case "DONE":
+		return 3
+	}
+	return 4
+}
+
+// order the listed jobs for the table: alerts first when pinned, then by
+// project when several are shown, then by the sort column, with ties
+// broken by job ID
+func order_jobids(db map[string]recStruct, ids []string, alerts map[string]string) []string {
+	group_projects := showing_several_projects()
+	column := sort_columns[sort_index]
+	entries := make([]sortEntry, len(ids))
+	for i, id := range ids {
+		entries[i].id = id
+		entries[i].id_num, _ = strconv.Atoi(strings.SplitN(id, "[", 2)[0])
+		entries[i].alert = alerts[id] != ""
+		if group_projects {
+			entries[i].group = db[id].JOB_DESCRIPTION
+		}
+		entries[i].num, entries[i].text = column.key(db[id])
+		if math.IsNaN(entries[i].num) {
+			entries[i].missing, entries[i].num = true, 0
+		}
+	}
+
+	// job ID sorts use the tie-break below, which ignores direction, so
+	// reverse the numbers here when descending
+	by_jobid := sort_index == 1
+	sort.Slice(entries, func(i int, j int) bool {
+		a, b := entries[i], entries[j]
+		if pin_alerts && a.alert != b.alert {
+			return a.alert
+		}
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.missing != b.missing {
+			return b.missing
+		}
+		if a.num != b.num {
+			return (a.num < b.num) != sort_descending
+		}
+		if a.text != b.text {
+			return (a.text < b.text) != sort_descending
+		}
+		if a.id_num != b.id_num {
+			return (a.id_num < b.id_num) != (by_jobid && sort_descending)
+		}
+		return (a.id < b.id) != (by_jobid && sort_descending)
+	})
+
+	for i, entry := range entries {
+		ids[i] = entry.id
+	}
+	return ids
+}
+
+// move on to sorting by the next column
+func cycle_sort_column() {
+	sort_index = (sort_index + 1) % len(sort_columns)
+}
+
+// describe the current sort for the table title, empty for the default order
+func sort_description() string {
+	if sort_index == 0 && !sort_descending && pin_alerts {
+		return ""
+	}
+	direction := "▲"
+	if sort_descending {
+		direction = "▼"
+	}
+	description := "Sorted by " + sort_columns[sort_index].name + " " + direction
+	if !pin_alerts {
+		description += ", alerts unpinned"
+	}
+	return description
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// reset the sort settings changed by a test
+func resetSort() {
+	sort_index = 0
+	sort_descending = false
+	pin_alerts = true
+}
+
+func createSortTestDatabase() map[string]recStruct {
+	return map[string]recStruct{
+		"10000": {JOBID: "10000", STAT: "DONE", QUEUE: "normal", MAX_MEM: "1 Gbytes", MEMLIMIT: "10 G", RUN_TIME: "60 second(s)"},
+		"9999":  {JOBID: "9999", STAT: "RUN", QUEUE: "long", MAX_MEM: "5 Gbytes", MEMLIMIT: "10 G", COMPLETE: "20% L", RUN_TIME: "600 second(s)"},
+		"9998":  {JOBID: "9998", STAT: "EXIT", QUEUE: "basement", EXIT_REASON: "TERM_MEMLIMIT"},
+		"9997":  {JOBID: "9997", STAT: "RUN", QUEUE: "normal", MAX_MEM: "9.5 Gbytes", MEMLIMIT: "10 G", COMPLETE: "30% L", RUN_TIME: "900 second(s)"},
+	}
+}
+
+func orderedJobids(db map[string]recStruct, alerts map[string]string) string {
+	ids := []string{"10000", "9999", "9998", "9997"}
+	return strings.Join(order_jobids(db, ids, alerts), ",")
+}
+
+// Test the default order groups jobs by status, sorted numerically within each
+func TestOrderJobidsDefault(t *testing.T) {
+	defer resetSort()
+	db := createSortTestDatabase()
+
+	if result := orderedJobids(db, nil); result != "9997,9999,9998,10000" {
+		t.Errorf("Unexpected default order %s", result)
+	}
+
+	// alerts are pinned above every other job
+	alerts := map[string]string{"9999": "at memory limit"}
+	if result := orderedJobids(db, alerts); result != "9999,9997,9998,10000" {
+		t.Errorf("Expected alert to be pinned first, got %s", result)
+	}
+}
+
+// Test sorting by columns in both directions
+func TestOrderJobidsByColumn(t *testing.T) {
+	defer resetSort()
+	db := createSortTestDatabase()
+
+	sort_index = 1 // job ID
+	if result := orderedJobids(db, nil); result != "9997,9998,9999,10000" {
+		t.Errorf("Expected numeric job ID order, got %s", result)
+	}
+
+	sort_descending = true
+	if result := orderedJobids(db, nil); result != "10000,9999,9998,9997" {
+		t.Errorf("Expected descending job ID order, got %s", result)
+	}
+
+	sort_index = 2 // memory, jobs without a limit last in either direction
+	if result := orderedJobids(db, nil); result != "9997,9999,10000,9998" {
+		t.Errorf("Expected descending memory order, got %s", result)
+	}
+
+	sort_descending = false
+	if result := orderedJobids(db, nil); result != "10000,9999,9997,9998" {
+		t.Errorf("Expected ascending memory order with no limit last, got %s", result)
+	}
+
+	// unpinned alerts are sorted along with the other jobs
+	sort_index = 5 // queue
+	sort_descending = false
+	pin_alerts = false
+	alerts := map[string]string{"9997": "nearly at time limit"}
+	if result := orderedJobids(db, alerts); result != "9998,9999,9997,10000" {
+		t.Errorf("Expected queue order ignoring alerts, got %s", result)
+	}
+}
+
+// Test that cycling columns wraps back to the default order
+func TestCycleSortColumn(t *testing.T) {
+	defer resetSort()
+
+	for range sort_columns {
+		cycle_sort_column()
+	}
+	if sort_index != 0 || sort_description() != "" {
+		t.Errorf("Expected cycling through every column to return to the default, got %d", sort_index)
+	}
+
+	cycle_sort_column()
+	sort_descending = true
+	if sort_description() != "Sorted by job ID ▼" {
+		t.Errorf("Unexpected sort description %q", sort_description())
+	}
+}
+
+// Test jobs of several projects are grouped by project, below any alerts
+func TestOrderJobidsGroupedByProject(t *testing.T) {
+	defer resetSort()
+	defer func() { proj_name, projectBool = "", false }()
+	db := createSortTestDatabase()
+	for id, project := range map[string]string{"10000": "batch_01", "9999": "batch_02", "9998": "batch_01", "9997": "batch_02"} {
+		job := db[id]
+		job.JOB_DESCRIPTION = project
+		db[id] = job
+	}
+
+	proj_name, projectBool = "glob:batch_*", true
+	if result := orderedJobids(db, nil); result != "9998,10000,9997,9999" {
+		t.Errorf("Unexpected grouped order %s", result)
+	}
+	alerts := map[string]string{"9999": "at memory limit"}
+	if result := orderedJobids(db, alerts); result != "9999,9998,10000,9997" {
+		t.Errorf("Unexpected grouped order with an alert %s", result)
+	}
+	if header := table_header(); header[1] != "PROJECT" {
+		t.Errorf("Expected a project column, got %v", header)
+	}
+}
+
+// Test suspended jobs are listed after running jobs and before finished ones
+func TestOrderJobidsSuspended(t *testing.T) {
+	defer resetSort()
+	db := createSortTestDatabase()
+	db["9996"] = recStruct{JOBID: "9996", STAT: "USUSP", QUEUE: "long"}
+	ids := []string{"10000", "9999", "9998", "9997", "9996"}
+	if result := strings.Join(order_jobids(db, ids, nil), ","); result != "9997,9999,9996,9998,10000" {
+		t.Errorf("Unexpected order with a suspended job %s", result)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// how long to wait for another bj instance to finish with a project's
+// store before giving up, as bbolt allows one writer at a time
+const store_timeout = 5 * time.Second
+
+// buckets of the store, one store file per project
+var (
+	// JOBID to the job's latest record
+	jobs_bucket = []byte("jobs")
+	// STAT/JOBID of every job, for finding jobs in a state without reading them all
+	state_bucket = []byte("by_state")
+	// unix time + JOBID to a jobEvent, so events are kept in time order
+	events_bucket = []byte("events")
+	// a bucket per JOBID of unix time to resourceSample
+	samples_bucket = []byte("samples")
+	// unix time + JOBID of when each finished job was seen to finish
+	finished_bucket = []byte("by_finish")
+)
+
+// jobEvent records a job changing state, e.g. from PEND to RUN
+type jobEvent struct {
+	Time  int64  `json:"t"`
+	JOBID string `json:"jobid"`
+	From  string `json:"from"` // empty when the job was first seen
+	To    string `json:"to"`
+}
+
+// move a file that can't be parsed out of the way, keeping it for
+// inspection, and return an error saying where it went
+func backup_corrupt_file(path string, parse_err error) error {
+	backup := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(path, backup); err != nil {
+		return fmt.Errorf("%s is corrupt (%v) and couldn't be backed up: %v", path, parse_err, err)
+	}
+	return fmt.Errorf("%s was corrupt (%v), moved it to %s and started afresh", filepath.Base(path), parse_err, backup)
+}
+
+// whether LSF is done with a job, so its record won't change again
+func is_job_finished(job recStruct) bool {
+	return job.STAT == "DONE" || job.STAT == "EXIT"
+}
+
+// open the store, creating it if needed and migrating it if it's from an
+// older bj. A store only being read is opened read-only, so that other bj
+// instances can read it at the same time, and is only opened for writing
+// when it needs migrating. A file bbolt can't read is moved aside and a
+// fresh store made in its place
+func open_store(path string, writable bool) (*bolt.DB, error) {
+	options := &bolt.Options{Timeout: store_timeout, ReadOnly: !writable}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// bbolt can only create a store when opening it for writing
+		options.ReadOnly = false
+	}
+	store, err := bolt.Open(path, 0644, options)
+	if errors.Is(err, bolt.ErrInvalid) || errors.Is(err, bolt.ErrChecksum) || errors.Is(err, bolt.ErrVersionMismatch) {
+		// the next open starts afresh once it's out of the way
+		return nil, backup_corrupt_file(path, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var needs_preparing bool
+	err = store.View(func(tx *bolt.Tx) error {
+		var err error
+		needs_preparing, err = store_needs_preparing(tx)
+		return err
+	})
+	if err == nil && needs_preparing && options.ReadOnly {
+		store.Close()
+		prepared, err := open_store(path, true)
+		if err != nil {
+			return nil, err
+		}
+		prepared.Close()
+		return open_store(path, false)
+	}
+	if err == nil && needs_preparing {
+		err = store.Update(func(tx *bolt.Tx) error {
+			return prepare_store(tx, time.Now().Unix())
+		})
+	}
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// run fn in a transaction on the store, only keeping it open for as long
+// as fn takes so other bj instances watching the project can use it too
+func with_store(path string, writable bool, fn func(tx *bolt.Tx) error) error {
+	store, err := open_store(path, writable)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if writable {
+		return store.Update(fn)
+	}
+	return store.View(fn)
+}
+
+func time_key(t int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t))
+	return key
+}
+
+func state_key(stat string, jobid string) []byte {
+	return []byte(stat + "/" + jobid)
+}
+
+// whether a stored record should be kept over ours, which is only when
+// another bj instance has already seen the job finish
+func keep_stored_job(stored recStruct, ours recStruct) bool {
+	return is_job_finished(stored) && !is_job_finished(ours)
+}
+
+// save the jobs, recording an event for each that is new or has changed
+// state since it was last saved
+func store_jobs(tx *bolt.Tx, jobs map[string]recStruct, now int64) error {
+	jobs_b := tx.Bucket(jobs_bucket)
+	state_b := tx.Bucket(state_bucket)
+	events_b := tx.Bucket(events_bucket)
+
+	for id, job := range jobs {
+		value, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+
+		var stored recStruct
+		stored_value := jobs_b.Get([]byte(id))
+		if stored_value != nil {
+			if bytes.Equal(stored_value, value) {
+				continue
+			}
+			if err := json.Unmarshal(stored_value, &stored); err != nil {
+				return err
+			}
+			if keep_stored_job(stored, job) {
+				continue
+			}
+		}
+
+		if stored_value == nil || stored.STAT != job.STAT {
+			if stored_value != nil {
+				if err := state_b.Delete(state_key(stored.STAT, id)); err != nil {
+					return err
+				}
+			}
+			if err := state_b.Put(state_key(job.STAT, id), nil); err != nil {
+				return err
+			}
+			event, err := json.Marshal(jobEvent{Time: now, JOBID: id, From: stored.STAT, To: job.STAT})
+			if err != nil {
+				return err
+			}
+			if err := events_b.Put(append(time_key(now), id...), event); err != nil {
+				return err
+			}
+			if is_job_finished(job) && !is_job_finished(stored) {
+				if err := tx.Bucket(finished_bucket).Put(append(time_key(now), id...), nil); err != nil {
+					return err
+				}
+			}
+		}
+		if err := jobs_b.Put([]byte(id), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build the finish time index from the events of jobs reaching DONE or EXIT
+func index_finish_times(tx *bolt.Tx) error {
+	if tx.Bucket(finished_bucket) != nil {
+		if err := tx.DeleteBucket(finished_bucket); err != nil {
+			return err
+		}
+	}
+	finished_b, err := tx.CreateBucket(finished_bucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(events_bucket).ForEach(func(k []byte, value []byte) error {
+		var event jobEvent
+		if err := json.Unmarshal(value, &event); err != nil {
+			return err
+		}
+		if event.To != "DONE" && event.To != "EXIT" {
+			return nil
+		}
+		return finished_b.Put(append(time_key(event.Time), event.JOBID...), nil)
+	})
+}
+
+func load_jobs(tx *bolt.Tx) (map[string]recStruct, error) {
+	jobs := make(map[string]recStruct)
+	err := tx.Bucket(jobs_bucket).ForEach(func(id []byte, value []byte) error {
+		var job recStruct
+		if err := json.Unmarshal(value, &job); err != nil {
+			return err
+		}
+		jobs[string(id)] = job
+		return nil
+	})
+	return jobs, err
+}
+
+// IDs of the stored jobs in a state, e.g. every EXIT job
+func jobs_in_state(tx *bolt.Tx, stat string) []string {
+	var ids []string
+	prefix := []byte(stat + "/")
+	c := tx.Bucket(state_bucket).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, string(k[len(prefix):]))
+	}
+	return ids
+}
+
+// finishedJob is a finished job in the store and when it finished
+type finishedJob struct {
+	id       string
+	stat     string
+	finished int64
+}
+
+// every finished job in the store, in the order they finished
+func finished_jobs(tx *bolt.Tx) []finishedJob {
+	var finished []finishedJob
+	jobs_b := tx.Bucket(jobs_bucket)
+	c := tx.Bucket(finished_bucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		id := string(k[8:])
+		var job recStruct
+		value := jobs_b.Get([]byte(id))
+		if value == nil || json.Unmarshal(value, &job) != nil || !is_job_finished(job) {
+			continue
+		}
+		finished = append(finished, finishedJob{id: id, stat: job.STAT, finished: int64(binary.BigEndian.Uint64(k[:8]))})
+	}
+	return finished
+}
+
+// remove jobs from the store along with their resource samples and
+// events, so the store doesn't grow without bound. Jobs cleared by the user
+// are archived first, keeping their events there
+func delete_jobs(tx *bolt.Tx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	remove := make(map[string]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	jobs_b := tx.Bucket(jobs_bucket)
+	state_b := tx.Bucket(state_bucket)
+	samples_b := tx.Bucket(samples_bucket)
+	for id := range remove {
+		var job recStruct
+		if value := jobs_b.Get([]byte(id)); value != nil {
+			if err := json.Unmarshal(value, &job); err == nil {
+				if err := state_b.Delete(state_key(job.STAT, id)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := jobs_b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		if samples_b.Bucket([]byte(id)) != nil {
+			if err := samples_b.DeleteBucket([]byte(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// events and finish times are keyed by time, so go through them once,
+	// collecting the keys first as deleting while iterating skips keys
+	for _, name := range [][]byte{events_bucket, finished_bucket} {
+		b := tx.Bucket(name)
+		var keys [][]byte
+		b.ForEach(func(k []byte, _ []byte) error {
+			if remove[string(k[8:])] {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save the samples not yet in the store, and drop those that have aged
+// out of the in-memory history
+func store_samples(tx *bolt.Tx, history map[string][]resourceSample) error {
+	samples_b := tx.Bucket(samples_bucket)
+	for id, samples := range history {
+		if len(samples) == 0 {
+			continue
+		}
+		job_b, err := samples_b.CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+
+		c := job_b.Cursor()
+		last_key, _ := c.Last()
+		for _, sample := range samples {
+			key := time_key(sample.Time)
+			if last_key != nil && bytes.Compare(key, last_key) <= 0 {
+				continue
+			}
+			value, err := json.Marshal(sample)
+			if err != nil {
+				return err
+			}
+			if err := job_b.Put(key, value); err != nil {
+				return err
+			}
+		}
+
+		oldest := time_key(samples[0].Time)
+		for k, _ := c.First(); k != nil && bytes.Compare(k, oldest) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func load_samples(tx *bolt.Tx) (map[string][]resourceSample, error) {
+	history := make(map[string][]resourceSample)
+	samples_b := tx.Bucket(samples_bucket)
+	err := samples_b.ForEach(func(id []byte, _ []byte) error {
+		return samples_b.Bucket(id).ForEach(func(_ []byte, value []byte) error {
+			var sample resourceSample
+			if err := json.Unmarshal(value, &sample); err != nil {
+				return err
+			}
+			history[string(id)] = append(history[string(id)], sample)
+			return nil
+		})
+	})
+	return history, err
+}
+
+// import the JSON cache and resource history earlier versions of bj
+// saved for a project, renaming them once imported so it only happens once
+func migrate_json_cache(project string, store_path string, legacy_cache string, legacy_history string) error {
+	var jobs map[string]recStruct
+	var history map[string][]resourceSample
+	for _, legacy := range []struct {
+		path  string
+		value interface{}
+	}{{legacy_cache, &jobs}, {legacy_history, &history}} {
+		legacy_json, err := ioutil.ReadFile(legacy.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(legacy_json, legacy.value); err != nil {
+			return backup_corrupt_file(legacy.path, err)
+		}
+	}
+	if jobs == nil && history == nil {
+		return nil
+	}
+
+	err := with_store(store_path, true, func(tx *bolt.Tx) error {
+		// the old cache has no timestamps, so its jobs are dated to the migration
+		now := time.Now().Unix()
+		if err := store_jobs(tx, jobs, now); err != nil {
+			return err
+		}
+		if err := touch_store_meta(tx, project, now); err != nil {
+			return err
+		}
+		for id, samples := range history {
+			sort.Slice(samples, func(i int, j int) bool { return samples[i].Time < samples[j].Time })
+			history[id] = samples
+		}
+		return store_samples(tx, history)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{legacy_cache, legacy_history} {
+		if _, err := os.Stat(path); err == nil {
+			if err := os.Rename(path, path+".migrated"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
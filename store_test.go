@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// every state change recorded in the store, in time order
+func stored_events(tx *bolt.Tx) ([]jobEvent, error) {
+	var events []jobEvent
+	err := tx.Bucket(events_bucket).ForEach(func(_ []byte, value []byte) error {
+		var event jobEvent
+		if err := json.Unmarshal(value, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func TestStoreJobsRecordsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+
+	steps := []struct {
+		now  int64
+		jobs map[string]recStruct
+	}{
+		{100, map[string]recStruct{"1": {JOBID: "1", STAT: "PEND"}, "2": {JOBID: "2", STAT: "RUN"}}},
+		// job 2's memory changes without changing state, so records no event
+		{200, map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}, "2": {JOBID: "2", STAT: "RUN", MAX_MEM: "1 Gbytes"}}},
+		{300, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}, "2": {JOBID: "2", STAT: "EXIT"}}},
+	}
+	for _, step := range steps {
+		err := with_store(path, true, func(tx *bolt.Tx) error { return store_jobs(tx, step.jobs, step.now) })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := with_store(path, false, func(tx *bolt.Tx) error {
+		events, err := stored_events(tx)
+		if err != nil {
+			return err
+		}
+		expected := []jobEvent{
+			{100, "1", "", "PEND"}, {100, "2", "", "RUN"},
+			{200, "1", "PEND", "RUN"},
+			{300, "1", "RUN", "DONE"}, {300, "2", "RUN", "EXIT"},
+		}
+		if len(events) != len(expected) {
+			t.Fatalf("Expected %d events, got %v", len(expected), events)
+		}
+		for i := range expected {
+			if events[i] != expected[i] {
+				t.Errorf("Event %d = %+v, expected %+v", i, events[i], expected[i])
+			}
+		}
+
+		if ids := jobs_in_state(tx, "EXIT"); len(ids) != 1 || ids[0] != "2" {
+			t.Errorf("Expected job 2 to be the only EXIT job, got %v", ids)
+		}
+		if ids := jobs_in_state(tx, "RUN"); len(ids) != 0 {
+			t.Errorf("Expected no jobs left running, got %v", ids)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreJobsKeepsFinishedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	write := func(jobs map[string]recStruct) {
+		if err := with_store(path, true, func(tx *bolt.Tx) error { return store_jobs(tx, jobs, 0) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// another instance saw the job finish before this one polled again
+	write(map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}})
+	write(map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}})
+
+	db, err := readJobCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db["1"].STAT != "DONE" {
+		t.Errorf("Expected the finished record to be kept, got %s", db["1"].STAT)
+	}
+}
+
+func TestWriteDatabaseConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+
+	// each writer knows about a different job, and every job should survive
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			err := with_store(path, true, func(tx *bolt.Tx) error {
+				return store_jobs(tx, map[string]recStruct{id: {JOBID: id, STAT: "RUN"}}, 0)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	db, err := readJobCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db) != 20 {
+		t.Errorf("Expected all 20 jobs in the store, got %d", len(db))
+	}
+}
+
+func TestStoreSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history := map[string][]resourceSample{"1": {{Time: 30, Mem: 1}, {Time: 60, Mem: 2}}}
+	write := func() {
+		if err := with_store(path, true, func(tx *bolt.Tx) error { return store_samples(tx, history) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write()
+
+	// a new sample is added and the oldest ages out of the in-memory history
+	history["1"] = append(history["1"][1:], resourceSample{Time: 90, Mem: 3})
+	write()
+
+	var loaded map[string][]resourceSample
+	err := with_store(path, false, func(tx *bolt.Tx) error {
+		var err error
+		loaded, err = load_samples(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded["1"]) != 2 || loaded["1"][0] != history["1"][0] || loaded["1"][1] != history["1"][1] {
+		t.Errorf("Expected %v, got %v", history["1"], loaded["1"])
+	}
+}
+
+func TestBackupCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+	if err := ioutil.WriteFile(path, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := backup_corrupt_file(path, os.ErrInvalid)
+	if _, stat_err := os.Stat(path); !os.IsNotExist(stat_err) {
+		t.Error("Expected the corrupt file to be moved aside")
+	}
+	backups, _ := filepath.Glob(path + ".corrupt-*")
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup of the corrupt file, got %v", backups)
+	}
+	if !strings.Contains(err.Error(), backups[0]) {
+		t.Errorf("Expected the error to say where the backup is, got %q", err)
+	}
+}
+
+func TestIsJobFinished(t *testing.T) {
+	for stat, expected := range map[string]bool{"DONE": true, "EXIT": true, "RUN": false, "PEND": false, "USUSP": false} {
+		if got := is_job_finished(recStruct{STAT: stat}); got != expected {
+			t.Errorf("is_job_finished(%s) = %v, expected %v", stat, got, expected)
+		}
+	}
+}
+
+func TestOpenStoreBacksUpCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	garbage := make([]byte, 8192)
+	for i := range garbage {
+		garbage[i] = 0xAB
+	}
+	if err := ioutil.WriteFile(path, garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readJobCache(path); err == nil {
+		t.Fatal("Expected an error reading a corrupt store")
+	}
+	if backups, _ := filepath.Glob(path + ".corrupt-*"); len(backups) != 1 {
+		t.Errorf("Expected the corrupt store to be backed up, got %v", backups)
+	}
+
+	// the next use starts a fresh store
+	if db, err := readJobCache(path); err != nil || len(db) != 0 {
+		t.Errorf("Expected an empty store after the backup, got %v %v", db, err)
+	}
+}
+
+// Test that deleting jobs removes their events too, so the store doesn't
+// keep growing as jobs are pruned
+func TestDeleteJobsRemovesEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	err := with_store(path, true, func(tx *bolt.Tx) error {
+		if err := store_jobs(tx, map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}, "2": {JOBID: "2", STAT: "RUN"}}, 100); err != nil {
+			return err
+		}
+		if err := store_jobs(tx, map[string]recStruct{"1": {JOBID: "1", STAT: "DONE"}, "2": {JOBID: "2", STAT: "EXIT"}}, 200); err != nil {
+			return err
+		}
+		return delete_jobs(tx, []string{"1"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with_store(path, false, func(tx *bolt.Tx) error {
+		events, err := stored_events(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range events {
+			if event.JOBID == "1" {
+				t.Errorf("Expected the deleted job's events to be removed, got %+v", event)
+			}
+		}
+		if len(events) != 2 {
+			t.Errorf("Expected job 2's 2 events to be kept, got %v", events)
+		}
+		return nil
+	})
+}
+
+// Test that a store that's up to date is opened read-only, so several
+// readers can have it open at once
+func TestOpenStoreReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	writeDatabase(filepath.Dir(path), path, map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}}, nil)
+
+	reader, err := open_store(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if !reader.IsReadOnly() {
+		t.Error("Expected an up to date store to be opened read-only")
+	}
+	if db, err := readJobCache(path); err != nil || len(db) != 1 {
+		t.Errorf("Expected to read the store while another reader has it open, got %v %v", db, err)
+	}
+}
+
+func TestMigrateJsonCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+	legacy_cache := filepath.Join(dir, "savedDatabase.json")
+	legacy_history := filepath.Join(dir, "savedHistory.json")
+
+	jobs := createTestDatabase()
+	cache_json, _ := json.Marshal(jobs)
+	history_json, _ := json.Marshal(map[string][]resourceSample{"81061": {{Time: 60, Mem: 2}, {Time: 30, Mem: 1}}})
+	ioutil.WriteFile(legacy_cache, cache_json, 0644)
+	ioutil.WriteFile(legacy_history, history_json, 0644)
+
+	// the store is stamped with the project migrated, not the one shown
+	if err := migrate_json_cache("fqcomp", path, legacy_cache, legacy_history); err != nil {
+		t.Fatal(err)
+	}
+	with_store(path, false, func(tx *bolt.Tx) error {
+		if meta, _, _ := read_store_meta(tx); meta.Project != "fqcomp" {
+			t.Errorf("Expected the store to record project fqcomp, got %q", meta.Project)
+		}
+		return nil
+	})
+
+	db, err := readJobCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db) != len(jobs) {
+		t.Errorf("Expected %d migrated jobs, got %d", len(jobs), len(db))
+	}
+	for id, job := range jobs {
+		if db[id] != job {
+			t.Errorf("Job %s migrated as %+v, expected %+v", id, db[id], job)
+		}
+	}
+
+	var history map[string][]resourceSample
+	with_store(path, false, func(tx *bolt.Tx) error {
+		history, err = load_samples(tx)
+		return err
+	})
+	if len(history["81061"]) != 2 || !sort.SliceIsSorted(history["81061"], func(i int, j int) bool { return history["81061"][i].Time < history["81061"][j].Time }) {
+		t.Errorf("Expected both samples migrated in time order, got %v", history["81061"])
+	}
+
+	// the old files are kept but renamed, so migration only happens once
+	for _, legacy := range []string{legacy_cache, legacy_history} {
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be renamed", legacy)
+		}
+		if _, err := os.Stat(legacy + ".migrated"); err != nil {
+			t.Errorf("Expected %s.migrated to exist", legacy)
+		}
+	}
+	if err := migrate_json_cache("", path, legacy_cache, legacy_history); err != nil {
+		t.Errorf("Expected nothing to migrate the second time, got %v", err)
+	}
+}
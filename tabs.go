@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// longest project name shown in a tab before it is shortened
+const max_tab_name = 20
+
+// projectTab is a project watched in its own tab. The tab being shown
+// keeps its state in the globals the job table is drawn from, and is only
+// saved into its projectTab when another tab is shown in its place
+type projectTab struct {
+	project    string
+	usr_config string
+	db         map[string]recStruct
+	history    map[string][]resourceSample
+	marked     map[string]bool
+	selected   string
+	offset     int
+	email      bool
+
+	// EXIT jobs already seen in the tab, so that only those that exited
+	// while it was in the background are counted in its badge
+	seen_exits map[string]bool
+	new_exits  int
+	alerts     int
+	// bjobs is running for the tab in the background
+	refreshing bool
+	// why the tab's last refresh failed, marked on its label until one succeeds
+	err error
+}
+
+// the open tabs and the index of the one being shown, with no tab bar
+// drawn while there's only one
+var project_tabs []*projectTab
+var active_tab int
+
+// rows taken by the tab bar above the job table
+func tab_bar_height() int {
+	if len(project_tabs) > 1 {
+		return 1
+	}
+	return 0
+}
+
+// index of the tab watching project, -1 if none is
+func tab_index(project string) int {
+	for i, tab := range project_tabs {
+		if tab.project == project {
+			return i
+		}
+	}
+	return -1
+}
+
+// run fn with the globals of the project in a background tab, for the
+// functions that act on the project being shown
+func (tab *projectTab) in_tab(fn func()) {
+	project, history, marked := proj_name, resource_history, marked_jobids
+	proj_name, projectBool, resource_history, marked_jobids = tab.project, tab.project != "", tab.history, tab.marked
+	defer func() {
+		proj_name, projectBool, resource_history, marked_jobids = project, project != "", history, marked
+	}()
+	fn()
+}
+
+// load a project's cache and current jobs into a new background tab
+func load_tab(usr_home string, project string) *projectTab {
+	tab := &projectTab{project: project, marked: make(map[string]bool)}
+	tab.in_tab(func() {
+		var err error
+		tab.usr_config, err = prepare_project_store(project)
+		if err != nil {
+			statusline.Text = "Error in migrating job cache: " + err.Error()
+			ui.Render(statusline_grid)
+		}
+		tab.db = readSavedDatabase(tab.usr_config)
+		tab.history = readSavedHistory(tab.usr_config)
+	})
+	tab.refresh(usr_home)
+	tab.mark_seen()
+	return tab
+}
+
+// update a background tab with what bjobs reports, saving its cache when
+// any of its jobs have changed
+func (tab *projectTab) refresh(usr_home string) {
+	tab.apply_refresh(refresh_tab_jobs(usr_home, tab.project, tab.usr_config, tab.db, tab.history))
+}
+
+// update a project's jobs and history with what bjobs reports, saving
+// them when any have changed. Only its arguments are used, so it can run
+// off the main loop on copies of a tab's jobs
+func refresh_tab_jobs(usr_home string, project string, usr_config string, db map[string]recStruct, history map[string][]resourceSample) (map[string]recStruct, map[string][]resourceSample, []string, error) {
+	bjobs_map, err := run_project_bjobs(project)
+	if err != nil {
+		return db, history, nil, fmt.Errorf("running bjobs: %v", err)
+	}
+	changed := record_resource_samples(history, bjobs_map, time.Now().Unix())
+	for id, job := range bjobs_map {
+		if stored, ok := db[id]; !ok || stored != job {
+			changed = true
+		}
+	}
+	db = updateDatabase(db, bjobs_map)
+	if !changed {
+		return db, history, nil, nil
+	}
+	expired, err := save_store(usr_home, usr_config, project, db, history)
+	for _, id := range expired {
+		delete(db, id)
+		delete(history, id)
+	}
+	return db, history, expired, err
+}
+
+// take on the jobs a refresh fetched, dropping marks on those removed
+func (tab *projectTab) apply_refresh(db map[string]recStruct, history map[string][]resourceSample, expired []string, err error) {
+	tab.db, tab.history = db, history
+	for _, id := range expired {
+		delete(tab.marked, id)
+	}
+	// only reported when it starts failing, the label marking it after that
+	failing := tab.err != nil
+	tab.err = err
+	if err != nil && !failing {
+		async_statusline_message("Error refreshing "+project_display_name(tab.project)+": "+err.Error(), 3)
+	}
+	tab.update_badge()
+}
+
+// whether the tab is still open and not being shown
+func (tab *projectTab) in_background() bool {
+	for i, open := range project_tabs {
+		if open == tab {
+			return i != active_tab
+		}
+	}
+	return false
+}
+
+// count the jobs that exited since the tab was last shown and those
+// needing attention
+func (tab *projectTab) update_badge() {
+	tab.new_exits = 0
+	tab.alerts = 0
+	for id, job := range tab.db {
+		if job.STAT == "EXIT" && !tab.seen_exits[id] {
+			tab.new_exits++
+		}
+		if alert, _ := job_alert(job, tab.history[id]); alert != "" {
+			tab.alerts++
+		}
+	}
+}
+
+// treat every EXIT job in the tab as seen, clearing its badge
+func (tab *projectTab) mark_seen() {
+	tab.seen_exits = make(map[string]bool)
+	for id, job := range tab.db {
+		if job.STAT == "EXIT" {
+			tab.seen_exits[id] = true
+		}
+	}
+	tab.new_exits = 0
+	tab.alerts = 0
+}
+
+// the tab's name, with a badge of new EXIT jobs (✖) and alerts (⚠) while
+// it's in the background
+func (tab *projectTab) label(active bool) string {
+	name := []rune(project_display_name(tab.project))
+	if len(name) > max_tab_name {
+		name = append(name[:max_tab_name], []rune("...")...)
+	}
+	label := " " + string(name)
+	if !active && tab.new_exits > 0 {
+		label += " ✖" + strconv.Itoa(tab.new_exits)
+	}
+	if !active && tab.alerts > 0 {
+		label += " ⚠" + strconv.Itoa(tab.alerts)
+	}
+	if tab.err != nil {
+		label += " !"
+	}
+	return label + " "
+}
+
+// keep the state of the tab being shown in it, from the globals and the
+// store and jobs main holds
+func (tab *projectTab) save(usr_config string, db map[string]recStruct) {
+	tab.project = proj_name
+	tab.usr_config = usr_config
+	tab.db = db
+	tab.history = resource_history
+	tab.marked = marked_jobids
+	tab.selected = selected_jobid
+	tab.offset = table_offset
+	tab.email = email_on
+	tab.mark_seen()
+}
+
+// make a tab the one shown, returning its store and jobs for main to hold
+func show_tab(i int, usr_config string, db map[string]recStruct) (string, map[string]recStruct) {
+	project_tabs[active_tab].save(usr_config, db)
+	active_tab = i
+	tab := project_tabs[i]
+	proj_name = tab.project
+	projectBool = tab.project != ""
+	resource_history = tab.history
+	marked_jobids = tab.marked
+	selected_jobid = tab.selected
+	table_offset = tab.offset
+	email_on = tab.email
+	tab.mark_seen()
+	set_project_label()
+	return tab.usr_config, tab.db
+}
+
+// open a project in a new tab and show it, or show its tab if it already has one
+func open_tab(usr_home string, project string, usr_config string, db map[string]recStruct) (string, map[string]recStruct) {
+	if i := tab_index(project); i != -1 {
+		return show_tab(i, usr_config, db)
+	}
+	project_tabs = append(project_tabs, load_tab(usr_home, project))
+	return show_tab(len(project_tabs)-1, usr_config, db)
+}
+
+// close the tab being shown and show its neighbour, keeping the last tab open
+func close_tab(usr_home string, usr_config string, db map[string]recStruct) (string, map[string]recStruct) {
+	if len(project_tabs) < 2 {
+		return usr_config, db
+	}
+	writeDatabase(usr_home, usr_config, db, resource_history)
+
+	closing := active_tab
+	next := closing + 1
+	if next == len(project_tabs) {
+		next = closing - 1
+	}
+	usr_config, db = show_tab(next, usr_config, db)
+	project_tabs = append(project_tabs[:closing], project_tabs[closing+1:]...)
+	if active_tab > closing {
+		active_tab--
+	}
+	return usr_config, db
+}
+
+// refresh every background tab at once, each in its own goroutine on
+// copies of its jobs so the main loop isn't held up by bjobs, applying
+// the results through ui_updates. A tab shown or closed in the meantime
+// keeps what it has, as it may have newer jobs than the refresh
+func refresh_background_tabs(usr_home string) {
+	for i, tab := range project_tabs {
+		if i == active_tab || tab.refreshing {
+			continue
+		}
+		tab.refreshing = true
+		db := make(map[string]recStruct, len(tab.db))
+		for id, job := range tab.db {
+			db[id] = job
+		}
+		// capped so that appending samples copies them rather than
+		// writing into what the tab still holds
+		history := make(map[string][]resourceSample, len(tab.history))
+		for id, samples := range tab.history {
+			history[id] = samples[:len(samples):len(samples)]
+		}
+		go func(tab *projectTab, project string, usr_config string) {
+			db, history, expired, err := refresh_tab_jobs(usr_home, project, usr_config, db, history)
+			ui_updates <- func() {
+				tab.refreshing = false
+				if tab.in_background() {
+					tab.apply_refresh(db, history, expired, err)
+				}
+			}
+		}(tab, tab.project, tab.usr_config)
+	}
+}
+
+// draw the tab bar above the job table when more than one tab is open
+func render_tab_bar() {
+	if len(project_tabs) < 2 {
+		return
+	}
+	var labels []string
+	for i, tab := range project_tabs {
+		labels = append(labels, tab.label(i == active_tab))
+	}
+	tab_bar := widgets.NewTabPane(labels...)
+	tab_bar.ActiveTabIndex = active_tab
+	tab_bar.ActiveTabStyle = ui.NewStyle(ColorYellow, ui.ColorClear, ui.ModifierReverse)
+	tab_bar.InactiveTabStyle = ui.NewStyle(ColorGrey)
+	tab_bar.Border = false
+	tab_bar.SetRect(0, 0, termWidth, 1)
+	ui.Render(tab_bar)
+}
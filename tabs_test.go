@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gizak/termui/v3/widgets"
+)
+
+func TestTabBadge(t *testing.T) {
+	tab := &projectTab{project: "fq compression", db: map[string]recStruct{
+		"1": {JOBID: "1", STAT: "EXIT"},
+		"2": {JOBID: "2", STAT: "RUN", COMPLETE: "97% L"},
+	}}
+	tab.mark_seen()
+	if tab.label(false) != " fq compression " {
+		t.Errorf("Expected no badge once the tab has been seen, got %q", tab.label(false))
+	}
+
+	tab.db["3"] = recStruct{JOBID: "3", STAT: "EXIT"}
+	tab.update_badge()
+	if tab.new_exits != 1 || tab.alerts != 1 {
+		t.Errorf("Expected 1 new EXIT job and 1 alert, got %d and %d", tab.new_exits, tab.alerts)
+	}
+	if got := tab.label(false); got != " fq compression ✖1 ⚠1 " {
+		t.Errorf("Unexpected background tab label %q", got)
+	}
+	if got := tab.label(true); got != " fq compression " {
+		t.Errorf("Expected no badge on the tab being shown, got %q", got)
+	}
+
+	long := &projectTab{project: "a very long project name indeed"}
+	if got := long.label(true); got != " a very long project ... " {
+		t.Errorf("Expected a long name to be shortened, got %q", got)
+	}
+}
+
+func TestShowAndCloseTab(t *testing.T) {
+	dir := t.TempDir()
+	project_name_label = widgets.NewParagraph()
+	defer func() { project_tabs, active_tab, proj_name, projectBool = nil, 0, "", false }()
+
+	first_db := map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}}
+	second := &projectTab{project: "align", usr_config: filepath.Join(dir, "align.db"), db: map[string]recStruct{"2": {JOBID: "2", STAT: "EXIT"}},
+		history: make(map[string][]resourceSample), marked: map[string]bool{"2": true}, selected: "2"}
+	project_tabs = []*projectTab{{project: "fqcomp"}, second}
+	active_tab = 0
+	proj_name, projectBool = "fqcomp", true
+	marked_jobids = map[string]bool{"1": true}
+	selected_jobid = "1"
+
+	usr_config, db := show_tab(1, filepath.Join(dir, "fqcomp.db"), first_db)
+	if usr_config != second.usr_config || db["2"].STAT != "EXIT" || proj_name != "align" || !marked_jobids["2"] || selected_jobid != "2" {
+		t.Fatalf("Expected the second tab's state to be shown, got %s %v %s %v %s", usr_config, db, proj_name, marked_jobids, selected_jobid)
+	}
+	if first := project_tabs[0]; first.db["1"].STAT != "RUN" || !first.marked["1"] || first.selected != "1" {
+		t.Errorf("Expected the first tab to keep its state, got %+v", first)
+	}
+	if tab_bar_height() != 1 || tab_index("fqcomp") != 0 || tab_index("other") != -1 {
+		t.Error("Expected a tab bar and both tabs to be found by project")
+	}
+
+	usr_config, db = close_tab(dir+"/", usr_config, db)
+	if len(project_tabs) != 1 || active_tab != 0 || proj_name != "fqcomp" || db["1"].STAT != "RUN" {
+		t.Errorf("Expected the first tab shown after closing the second, got %d tabs, %s", len(project_tabs), proj_name)
+	}
+	if _, db = close_tab(dir+"/", usr_config, db); len(project_tabs) != 1 {
+		t.Error("Expected the last tab to stay open")
+	}
+}
+
+// Test that a background refresh is only taken on by a tab still open
+// behind the one shown, and drops marks on jobs it removed
+func TestApplyBackgroundRefresh(t *testing.T) {
+	defer func() { project_tabs, active_tab = nil, 0 }()
+
+	shown := &projectTab{project: "fqcomp"}
+	background := &projectTab{project: "align", marked: map[string]bool{"1": true, "2": true}, seen_exits: make(map[string]bool)}
+	closed := &projectTab{project: "closed"}
+	project_tabs = []*projectTab{shown, background}
+	active_tab = 0
+	if shown.in_background() || !background.in_background() || closed.in_background() {
+		t.Fatal("Expected only the open tab behind the one shown to be in the background")
+	}
+
+	db := map[string]recStruct{"2": {JOBID: "2", STAT: "EXIT"}}
+	background.apply_refresh(db, make(map[string][]resourceSample), []string{"1"}, nil)
+	if background.db["2"].STAT != "EXIT" || background.marked["1"] || !background.marked["2"] {
+		t.Errorf("Expected the refreshed jobs and the removed job unmarked, got %v %v", background.db, background.marked)
+	}
+	if background.new_exits != 1 {
+		t.Errorf("Expected the new EXIT job in the badge, got %d", background.new_exits)
+	}
+}
+
+// Test that a failed bjobs in a background tab is passed back rather than
+// exiting, keeping the tab's jobs and marking its label
+func TestRefreshTabReportsBjobsErrors(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	db := map[string]recStruct{"1": {JOBID: "1", STAT: "RUN"}}
+	history := make(map[string][]resourceSample)
+
+	refreshed, _, expired, err := refresh_tab_jobs(t.TempDir(), "align", filepath.Join(t.TempDir(), "align.db"), db, history)
+	if err == nil {
+		t.Fatal("Expected an error when bjobs can't be run")
+	}
+	if refreshed["1"].STAT != "RUN" || len(expired) != 0 {
+		t.Errorf("Expected the tab's jobs to be kept, got %v %v", refreshed, expired)
+	}
+
+	tab := &projectTab{project: "align", err: err}
+	if label := tab.label(false); !strings.HasSuffix(label, " ! ") {
+		t.Errorf("Expected the label to show the refresh failed, got %q", label)
+	}
+}